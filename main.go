@@ -10,8 +10,16 @@ import (
 )
 
 import (
+	_ "github.com/gogap/go-pandoc/pandoc/fetcher/archive"
 	_ "github.com/gogap/go-pandoc/pandoc/fetcher/data"
+	_ "github.com/gogap/go-pandoc/pandoc/fetcher/file"
+	_ "github.com/gogap/go-pandoc/pandoc/fetcher/git"
 	_ "github.com/gogap/go-pandoc/pandoc/fetcher/http"
+	_ "github.com/gogap/go-pandoc/pandoc/fetcher/s3"
+
+	_ "github.com/gogap/go-pandoc/server/jobstore/disk"
+	_ "github.com/gogap/go-pandoc/server/jobstore/memory"
+	_ "github.com/gogap/go-pandoc/server/ratelimit/memory"
 )
 
 func main() {
@@ -0,0 +1,37 @@
+package cache
+
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+}
+
+type chain []Cache
+
+// Chain looks up the caches in order, and fills the former caches when
+// the later one hits, e.g. the memory cache before the disk cache
+func Chain(caches ...Cache) Cache {
+	return chain(caches)
+}
+
+func (p chain) Get(key string) (data []byte, ok bool) {
+	for i := 0; i < len(p); i++ {
+		data, ok = p[i].Get(key)
+		if !ok {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			p[j].Set(key, data)
+		}
+
+		return
+	}
+
+	return
+}
+
+func (p chain) Set(key string, data []byte) {
+	for i := 0; i < len(p); i++ {
+		p[i].Set(key, data)
+	}
+}
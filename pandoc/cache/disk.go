@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"container/list"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tempFilePrefix = ".tmp-"
+
+type diskEntry struct {
+	key  string
+	size int64
+}
+
+// DiskCache is a LRU cache of files bounded by the total size of them, the
+// modified time of file is the last access time, so the order is kept
+// after restarting
+type DiskCache struct {
+	dir     string
+	maxSize int64 // no limit if <= 0
+	size    int64
+
+	items map[string]*list.Element
+	lru   *list.List
+
+	locker sync.Mutex
+}
+
+func NewDiskCache(dir string, maxSize int64) (c *DiskCache, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	c = &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	// the oldest is pushed first, so it is at the back
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		// the temp files of the interrupted writes
+		if strings.HasPrefix(fi.Name(), tempFilePrefix) {
+			os.Remove(filepath.Join(dir, fi.Name()))
+			continue
+		}
+
+		c.items[fi.Name()] = c.lru.PushFront(&diskEntry{key: fi.Name(), size: fi.Size()})
+		c.size += fi.Size()
+	}
+
+	c.locker.Lock()
+	c.evict()
+	c.locker.Unlock()
+
+	return
+}
+
+func (p *DiskCache) Get(key string) (data []byte, ok bool) {
+	fname := filepath.Join(p.dir, key)
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return
+	}
+
+	ok = true
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if elem, exist := p.items[key]; exist {
+		p.lru.MoveToFront(elem)
+
+		now := time.Now()
+		os.Chtimes(fname, now, now)
+	}
+
+	return
+}
+
+// Set writes to a temp file and then renames it, so the concurrent
+// readers never get a partial file, the least recently used files are
+// removed if the total size exceeds max size
+func (p *DiskCache) Set(key string, data []byte) {
+
+	size := int64(len(data))
+
+	if p.maxSize > 0 && size > p.maxSize {
+		return
+	}
+
+	f, err := ioutil.TempFile(p.dir, tempFilePrefix)
+	if err != nil {
+		log.Printf("[cache]: create cache file failure: %s\n", err)
+		return
+	}
+
+	_, err = f.Write(data)
+	f.Close()
+
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(p.dir, key))
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		log.Printf("[cache]: write cache file failure: %s\n", err)
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	// the file is replaced, so only the entry is removed
+	if elem, exist := p.items[key]; exist {
+		p.removeEntry(elem)
+	}
+
+	p.items[key] = p.lru.PushFront(&diskEntry{key: key, size: size})
+	p.size += size
+
+	p.evict()
+}
+
+// Size returns the total size of the files
+func (p *DiskCache) Size() int64 {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.size
+}
+
+func (p *DiskCache) evict() {
+	if p.maxSize <= 0 {
+		return
+	}
+
+	for p.size > p.maxSize && p.lru.Len() > 0 {
+		e := p.removeEntry(p.lru.Back())
+
+		err := os.Remove(filepath.Join(p.dir, e.key))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("[cache]: remove cache file failure: %s\n", err)
+		}
+	}
+}
+
+func (p *DiskCache) removeEntry(elem *list.Element) *diskEntry {
+	e := p.lru.Remove(elem).(*diskEntry)
+	delete(p.items, e.key)
+	p.size -= e.size
+
+	return e
+}
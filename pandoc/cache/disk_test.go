@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := NewDiskCache(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("a", make([]byte, 10))
+	c.Set("b", make([]byte, 10))
+	c.Set("c", make([]byte, 10))
+
+	// a is used recently, so b is the oldest
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+
+	c.Set("d", make([]byte, 10))
+
+	for key, cached := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok := c.Get(key); ok != cached {
+			t.Fatalf("%s is cached: %v, expected: %v", key, ok, cached)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, key)); (err == nil) != cached {
+			t.Fatalf("the file of %s exists: %v, expected: %v", key, err == nil, cached)
+		}
+	}
+
+	// larger than max size
+	c.Set("e", make([]byte, 31))
+
+	if _, ok := c.Get("e"); ok || c.Size() != 30 {
+		t.Fatalf("e should not be cached, size: %d", c.Size())
+	}
+
+	// replaced
+	c.Set("d", make([]byte, 5))
+
+	if c.Size() != 25 {
+		t.Fatalf("unexpected size %d", c.Size())
+	}
+}
+
+func TestDiskCacheReload(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+
+	for i, key := range []string{"old", "mid", "new"} {
+		fname := filepath.Join(dir, key)
+
+		err := ioutil.WriteFile(fname, make([]byte, 10), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mtime := now.Add(time.Duration(i-3) * time.Hour)
+		os.Chtimes(fname, mtime, mtime)
+	}
+
+	err := ioutil.WriteFile(filepath.Join(dir, tempFilePrefix+"1"), make([]byte, 10), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest is removed when loaded
+	c, err := NewDiskCache(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Size() != 20 {
+		t.Fatalf("unexpected size %d", c.Size())
+	}
+
+	for key, cached := range map[string]bool{"old": false, "mid": true, "new": true, tempFilePrefix + "1": false} {
+		if _, err := os.Stat(filepath.Join(dir, key)); (err == nil) != cached {
+			t.Fatalf("the file of %s exists: %v, expected: %v", key, err == nil, cached)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type entry struct {
+	key  string
+	data []byte
+}
+
+// MemoryCache is a LRU cache bounded by the total size of the data
+type MemoryCache struct {
+	maxSize int64
+	size    int64
+
+	items map[string]*list.Element
+	lru   *list.List
+
+	locker sync.Mutex
+}
+
+func NewMemoryCache(maxSize int64) *MemoryCache {
+	return &MemoryCache{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (p *MemoryCache) Get(key string) (data []byte, ok bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	elem, ok := p.items[key]
+	if !ok {
+		return
+	}
+
+	p.lru.MoveToFront(elem)
+
+	data = elem.Value.(*entry).data
+
+	return
+}
+
+func (p *MemoryCache) Set(key string, data []byte) {
+
+	size := int64(len(data))
+
+	if size > p.maxSize {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if elem, exist := p.items[key]; exist {
+		p.remove(elem)
+	}
+
+	for p.size+size > p.maxSize {
+		p.remove(p.lru.Back())
+	}
+
+	p.items[key] = p.lru.PushFront(&entry{key: key, data: data})
+	p.size += size
+}
+
+func (p *MemoryCache) remove(elem *list.Element) {
+	e := p.lru.Remove(elem).(*entry)
+	delete(p.items, e.key)
+	p.size -= int64(len(e.data))
+}
@@ -0,0 +1,102 @@
+package pandoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capabilities is probed from the pandoc binary at startup
+type Capabilities struct {
+	Version         string   `json:"version"` // e.g. 3.1.9
+	VersionInfo     string   `json:"-"`       // the first line of --version
+	InputFormats    []string `json:"input_formats"`
+	OutputFormats   []string `json:"output_formats"`
+	Extensions      []string `json:"extensions"` // +name if it is enabled by default, otherwise -name
+	HighlightStyles []string `json:"highlight_styles"`
+
+	inputFormats  map[string]bool
+	outputFormats map[string]bool
+	extensions    map[string]bool
+}
+
+func probeCapabilities(bin string) (caps *Capabilities, err error) {
+
+	out, err := execCommand(context.Background(), time.Second*10, "", bin, "--version")
+	if err != nil {
+		err = fmt.Errorf("get pandoc version failure, error: %s", err)
+		return
+	}
+
+	caps = &Capabilities{}
+
+	if idx := bytes.IndexByte(out, '\n'); idx > 0 {
+		out = out[:idx]
+	}
+
+	caps.VersionInfo = strings.TrimSpace(string(out))
+
+	if fields := strings.Fields(caps.VersionInfo); len(fields) > 1 {
+		caps.Version = fields[1]
+	}
+
+	// the lists are not supported by the old versions, they are empty then
+	caps.InputFormats = listCapability(bin, "--list-input-formats")
+	caps.OutputFormats = listCapability(bin, "--list-output-formats")
+	caps.Extensions = listCapability(bin, "--list-extensions")
+	caps.HighlightStyles = listCapability(bin, "--list-highlight-styles")
+
+	caps.inputFormats = toSet(caps.InputFormats)
+	caps.outputFormats = toSet(caps.OutputFormats)
+
+	caps.extensions = make(map[string]bool, len(caps.Extensions))
+	for _, ext := range caps.Extensions {
+		caps.extensions[strings.TrimLeft(ext, "+-")] = true
+	}
+
+	return
+}
+
+func listCapability(bin, flag string) (list []string) {
+	out, err := execCommand(context.Background(), time.Second*10, "", bin, flag)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			list = append(list, line)
+		}
+	}
+
+	return
+}
+
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, v := range list {
+		set[v] = true
+	}
+	return set
+}
+
+// VersionAtLeast compares the version with the parts, e.g. VersionAtLeast(2, 11, 2)
+func (p *Capabilities) VersionAtLeast(version ...int) bool {
+	parts := strings.Split(p.Version, ".")
+
+	for i, want := range version {
+		v := 0
+		if i < len(parts) {
+			v, _ = strconv.Atoi(parts[i])
+		}
+
+		if v != want {
+			return v > want
+		}
+	}
+
+	return true
+}
@@ -2,16 +2,16 @@ package pandoc
 
 import (
 	"bytes"
-	"errors"
-	"io"
+	"context"
 	"os/exec"
 	"syscall"
 	"time"
 )
 
-func execCommand(timeout time.Duration, name string, args ...string) (result []byte, err error) {
+func execCommand(ctx context.Context, timeout time.Duration, dir, name string, args ...string) (result []byte, err error) {
 
 	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
 
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
@@ -23,22 +23,12 @@ func execCommand(timeout time.Duration, name string, args ...string) (result []b
 		return
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return
-	}
-
+	// the outputs are copied by cmd, and completed when Wait returns
 	outBuf := bytes.NewBuffer(nil)
 	errBuf := bytes.NewBuffer(nil)
 
-	if err != nil {
-		return
-	}
+	cmd.Stdout = outBuf
+	cmd.Stderr = errBuf
 
 	err = cmd.Start()
 
@@ -48,10 +38,8 @@ func execCommand(timeout time.Duration, name string, args ...string) (result []b
 
 	stdin.Close()
 
-	go io.Copy(outBuf, stdout)
-	go io.Copy(errBuf, stderr)
-
-	ch := make(chan error)
+	// buffered, so the goroutine is not blocked after timeout
+	ch := make(chan error, 1)
 
 	go func(cmd *exec.Cmd) {
 		defer close(ch)
@@ -61,14 +49,21 @@ func execCommand(timeout time.Duration, name string, args ...string) (result []b
 	select {
 	case err = <-ch:
 	case <-time.After(timeout):
-		cmd.Process.Kill()
-		err = errors.New("execute timeout")
+		killProcessGroup(cmd)
+		err = &TimeoutError{Timeout: timeout}
+		return
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		err = ctx.Err()
 		return
 	}
 
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, &ExitError{Code: exitErr.ExitCode(), Stderr: errBuf.String()}
+	}
+
 	if err != nil {
-		errStr := errBuf.String()
-		return nil, errors.New(errStr)
+		return
 	}
 
 	if outBuf.Len() > 0 {
@@ -77,3 +72,15 @@ func execCommand(timeout time.Duration, name string, args ...string) (result []b
 
 	return
 }
+
+// killProcessGroup kills the command and the children it spawned,
+// e.g. the pdf engine, the command is the leader of the group by Setpgid
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
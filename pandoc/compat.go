@@ -0,0 +1,134 @@
+package pandoc
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// the default url of --mathjax since pandoc 3
+const defaultMathjaxURL = "https://cdn.jsdelivr.net/npm/mathjax@3/es5/tex-chtml-full.js"
+
+// IntList is a list of int, it is unmarshaled from a number, e.g. 1, or a list, e.g. [1, 2]
+type IntList []int
+
+func (p *IntList) UnmarshalJSON(data []byte) (err error) {
+	var n int
+	if err = json.Unmarshal(data, &n); err == nil {
+		*p = IntList{n}
+		return
+	}
+
+	var list []int
+	if err = json.Unmarshal(data, &list); err != nil {
+		return
+	}
+
+	*p = list
+
+	return
+}
+
+// String returns the comma separated list, e.g. 1,2
+func (p IntList) String() string {
+	strs := make([]string, 0, len(p))
+	for _, v := range p {
+		strs = append(strs, strconv.Itoa(v))
+	}
+
+	return strings.Join(strs, ",")
+}
+
+// versionAtLeast is true if the version of pandoc is unknown, so the
+// options are passed as they are
+func (p *ConvertOptions) versionAtLeast(version ...int) bool {
+	return p.caps == nil || len(p.caps.Version) == 0 || p.caps.VersionAtLeast(version...)
+}
+
+// compat translates the deprecated options to the modern ones if pandoc
+// supports them, and the modern ones to the deprecated ones for the old
+// pandoc, nothing is translated if the version is unknown
+func (p *ConvertOptions) compat() {
+
+	if p.caps == nil || len(p.caps.Version) == 0 {
+		return
+	}
+
+	// removed in pandoc 3, the empty paragraphs are stripped unless the
+	// empty_paragraphs extension is enabled
+	if p.StripEmptyParagraphs && p.versionAtLeast(3) {
+		p.StripEmptyParagraphs = false
+	}
+
+	if p.versionAtLeast(2, 8) {
+		if p.BaseHeaderLevel != 0 && p.ShiftHeadingLevelBy == 0 {
+			p.ShiftHeadingLevelBy = p.BaseHeaderLevel - 1
+		}
+		p.BaseHeaderLevel = 0
+	} else if p.ShiftHeadingLevelBy > 0 && p.BaseHeaderLevel == 0 {
+		p.BaseHeaderLevel = p.ShiftHeadingLevelBy + 1
+		p.ShiftHeadingLevelBy = 0
+	}
+
+	if p.versionAtLeast(2, 11, 2) {
+		if p.AtxHeaders && len(p.MarkdownHeadings) == 0 {
+			p.MarkdownHeadings = "atx"
+		}
+		p.AtxHeaders = false
+	} else if p.MarkdownHeadings == "atx" {
+		p.AtxHeaders = true
+		p.MarkdownHeadings = ""
+	} else if p.MarkdownHeadings == "setext" {
+		// setext is the default of the old pandoc
+		p.MarkdownHeadings = ""
+	}
+
+	if p.versionAtLeast(2, 19) {
+		if p.SelfContained {
+			p.EmbedResources = true
+			p.Standalone = true
+		}
+		p.SelfContained = false
+	} else if p.EmbedResources {
+		p.SelfContained = true
+		p.EmbedResources = false
+	}
+
+	if p.versionAtLeast(3) {
+		if p.EpubChapterLevel != 0 && p.SplitLevel == 0 {
+			p.SplitLevel = p.EpubChapterLevel
+		}
+		p.EpubChapterLevel = 0
+	} else if p.SplitLevel != 0 && p.EpubChapterLevel == 0 {
+		p.EpubChapterLevel = p.SplitLevel
+		p.SplitLevel = 0
+	}
+
+	// the math renderers removed in pandoc 2 are replaced by the similar ones
+	if p.versionAtLeast(2) {
+		if len(p.Latexmathml) > 0 {
+			p.Mathml = true
+			p.Latexmathml = ""
+		}
+
+		if len(p.Jsmath) > 0 {
+			p.Mathjax = defaultMathjaxURL
+			p.Jsmath = ""
+		}
+
+		// the tex is appended to the url of webtex, mimetex cgi reads it as the query
+		if len(p.Mimetex) > 0 {
+			p.Webtex = p.Mimetex + "?"
+			p.Mimetex = ""
+		}
+	}
+}
+
+// citeprocArgs returns --citeproc, or the pandoc-citeproc filter before pandoc 2.11
+func (p *ConvertOptions) citeprocArgs() []string {
+	if p.versionAtLeast(2, 11) {
+		return []string{"--citeproc"}
+	}
+
+	return []string{"--filter", "pandoc-citeproc"}
+}
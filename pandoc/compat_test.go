@@ -0,0 +1,119 @@
+package pandoc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		at      []int
+		ok      bool
+	}{
+		{"2.11.2", []int{2, 11, 2}, true},
+		{"2.11.2", []int{2, 11, 3}, false},
+		{"2.11.2", []int{2, 10, 9}, true},
+		{"2.11.2", []int{2}, true},
+		{"2.11", []int{2, 11, 1}, false},
+		{"3.1.9", []int{2, 19}, true},
+		{"2.9", []int{2, 11}, false},
+	}
+
+	for _, test := range tests {
+		caps := &Capabilities{Version: test.version}
+		if caps.VersionAtLeast(test.at...) != test.ok {
+			t.Fatalf("%s at least %v should be %v", test.version, test.at, test.ok)
+		}
+	}
+}
+
+func TestCompat(t *testing.T) {
+	tests := []struct {
+		version string
+		opts    ConvertOptions
+		compat  ConvertOptions
+	}{
+		// unknown version, nothing is translated
+		{"", ConvertOptions{BaseHeaderLevel: 2, AtxHeaders: true, Latexmathml: "url"},
+			ConvertOptions{BaseHeaderLevel: 2, AtxHeaders: true, Latexmathml: "url"}},
+
+		// the deprecated options for the modern pandoc
+		{"3.1.9", ConvertOptions{BaseHeaderLevel: 3}, ConvertOptions{ShiftHeadingLevelBy: 2}},
+		{"3.1.9", ConvertOptions{BaseHeaderLevel: 3, ShiftHeadingLevelBy: 1}, ConvertOptions{ShiftHeadingLevelBy: 1}},
+		{"3.1.9", ConvertOptions{AtxHeaders: true}, ConvertOptions{MarkdownHeadings: "atx"}},
+		{"3.1.9", ConvertOptions{SelfContained: true}, ConvertOptions{EmbedResources: true, Standalone: true}},
+		{"3.1.9", ConvertOptions{EpubChapterLevel: 2}, ConvertOptions{SplitLevel: 2}},
+		{"3.1.9", ConvertOptions{StripEmptyParagraphs: true}, ConvertOptions{}},
+		{"2.19", ConvertOptions{StripEmptyParagraphs: true, EpubChapterLevel: 2}, ConvertOptions{StripEmptyParagraphs: true, EpubChapterLevel: 2}},
+		{"3.1.9", ConvertOptions{Latexmathml: "url"}, ConvertOptions{Mathml: true}},
+		{"3.1.9", ConvertOptions{Jsmath: "url"}, ConvertOptions{Mathjax: defaultMathjaxURL}},
+		{"3.1.9", ConvertOptions{Mimetex: "https://example.com/mimetex.cgi"}, ConvertOptions{Webtex: "https://example.com/mimetex.cgi?"}},
+
+		// the modern options for the old pandoc
+		{"2.5", ConvertOptions{ShiftHeadingLevelBy: 1}, ConvertOptions{BaseHeaderLevel: 2}},
+		{"2.5", ConvertOptions{MarkdownHeadings: "atx"}, ConvertOptions{AtxHeaders: true}},
+		{"2.5", ConvertOptions{MarkdownHeadings: "setext"}, ConvertOptions{}},
+		{"2.5", ConvertOptions{EmbedResources: true}, ConvertOptions{SelfContained: true}},
+		{"2.5", ConvertOptions{SplitLevel: 2}, ConvertOptions{EpubChapterLevel: 2}},
+		{"1.19", ConvertOptions{Latexmathml: "url"}, ConvertOptions{Latexmathml: "url"}},
+	}
+
+	for i, test := range tests {
+		opts := test.opts
+		if len(test.version) > 0 {
+			opts.caps = &Capabilities{Version: test.version}
+		}
+
+		opts.compat()
+
+		test.compat.caps = opts.caps
+
+		if !reflect.DeepEqual(opts, test.compat) {
+			t.Fatalf("%d: pandoc %s, unexpected options %+v, expected: %+v", i, test.version, opts, test.compat)
+		}
+	}
+}
+
+func TestCiteprocArgs(t *testing.T) {
+	tests := []struct {
+		version string
+		args    string
+	}{
+		{"", "--citeproc"},
+		{"2.11", "--citeproc"},
+		{"2.10.1", "--filter pandoc-citeproc"},
+	}
+
+	for _, test := range tests {
+		opts := ConvertOptions{caps: &Capabilities{Version: test.version}}
+
+		if args := strings.Join(opts.citeprocArgs(), " "); args != test.args {
+			t.Fatalf("%s: unexpected args %s", test.version, args)
+		}
+	}
+}
+
+func TestIntListUnmarshal(t *testing.T) {
+	tests := []struct {
+		data  string
+		value string
+		valid bool
+	}{
+		{`3`, "3", true},
+		{`[1, 0, 2]`, "1,0,2", true},
+		{`[]`, "", true},
+		{`"1"`, "", false},
+	}
+
+	for _, test := range tests {
+		var list IntList
+
+		err := json.Unmarshal([]byte(test.data), &list)
+		if (err == nil) != test.valid || (err == nil && list.String() != test.value) {
+			t.Fatalf("%s: unexpected %s, error: %v", test.data, list, err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package pandoc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gogap/config"
+)
+
+// Preset is a named pandoc defaults file configured by the operator,
+// the request references it by name and overrides the fields
+type Preset struct {
+	Name string `json:"name"`
+	File string `json:"-"`
+	From string `json:"from,omitempty"` // the reader of defaults file, used if the request has no from
+	To   string `json:"to,omitempty"`   // the writer of defaults file, used if the request has no to
+}
+
+// loadPresets loads the *.yaml and *.yml defaults files in dir, and the
+// files configured by name, the preset name of dir is the file name
+// without extension
+func loadPresets(conf config.Configuration) (presets map[string]*Preset, err error) {
+
+	presets = make(map[string]*Preset)
+
+	if conf == nil {
+		return
+	}
+
+	files := map[string]string{}
+
+	if dir := conf.GetString("dir"); len(dir) > 0 {
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+			for _, match := range matches {
+				files[strings.TrimSuffix(filepath.Base(match), filepath.Ext(match))] = match
+			}
+		}
+	}
+
+	if filesConf := conf.GetConfig("files"); filesConf != nil {
+		for _, name := range filesConf.Keys() {
+			files[name] = filesConf.GetString(name)
+		}
+	}
+
+	for name, file := range files {
+		var preset *Preset
+		preset, err = loadPreset(name, file)
+		if err != nil {
+			return
+		}
+
+		presets[name] = preset
+	}
+
+	return
+}
+
+func loadPreset(name, file string) (preset *Preset, err error) {
+
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		err = fmt.Errorf("load preset %s failure, error: %s", name, err)
+		return
+	}
+
+	preset = &Preset{Name: name, File: file}
+	preset.From, preset.To = scanDefaults(data)
+
+	return
+}
+
+// scanDefaults gets the top level from/reader and to/writer of the defaults
+// file, they are scalars so the yaml is not parsed
+func scanDefaults(data []byte) (from, to string) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if len(line) == 0 || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+
+		idx := strings.Index(line, ":")
+		if idx < 0 {
+			continue
+		}
+
+		value := line[idx+1:]
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		switch strings.TrimSpace(line[:idx]) {
+		case "from", "reader":
+			from = value
+		case "to", "writer":
+			to = value
+		}
+	}
+
+	return
+}
+
+// Presets returns the presets by name
+func (p *Pandoc) Presets() map[string]*Preset {
+	return p.presets
+}
+
+// ApplyPreset sets the from and to of the preset if they are empty, so
+// they could be checked before converting, it is applied again by Run
+func (p *Pandoc) ApplyPreset(convertOpts *ConvertOptions) (err error) {
+	if len(convertOpts.Preset) == 0 {
+		return
+	}
+
+	preset, exist := p.presets[convertOpts.Preset]
+	if !exist {
+		verr := &ValidationError{}
+		verr.add("preset", "%s not exist", convertOpts.Preset)
+		err = verr
+		return
+	}
+
+	if len(convertOpts.From) == 0 {
+		convertOpts.From = preset.From
+	}
+
+	if len(convertOpts.To) == 0 {
+		convertOpts.To = preset.To
+	}
+
+	convertOpts.preset = preset
+
+	return
+}
+
+// defaultsArgs returns the --defaults of the preset, and the defaults
+// generated by the variables, metadata and request headers, so the args
+// are not growing with them, the generated file is removed by cleanup
+func (p *ConvertOptions) defaultsArgs() (args []string, cleanup func(), err error) {
+
+	if p.preset != nil {
+		args = append(args, "--defaults", p.preset.File)
+	}
+
+	defaults := map[string]interface{}{}
+
+	if len(p.Variable) > 0 {
+		defaults["variables"] = p.Variable
+	}
+
+	if len(p.Metadata) > 0 {
+		metadata := map[string]interface{}{}
+		for k, values := range p.Metadata {
+			if len(values) > 0 {
+				metadata[k] = metadataValue(values)
+			}
+		}
+
+		defaults["metadata"] = metadata
+	}
+
+	if len(p.RequestHeader) > 0 {
+		keys := make([]string, 0, len(p.RequestHeader))
+		for k := range p.RequestHeader {
+			keys = append(keys, k)
+		}
+
+		// sorted, so the cache key of the same headers is the same
+		sort.Strings(keys)
+
+		headers := [][]string{}
+		for _, k := range keys {
+			headers = append(headers, []string{k, p.RequestHeader[k]})
+		}
+
+		defaults["request-headers"] = headers
+	}
+
+	if len(defaults) == 0 {
+		return
+	}
+
+	// json is a subset of yaml
+	data, err := json.Marshal(defaults)
+	if err != nil {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "go-pandoc-defaults-*.yaml")
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(data)
+
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+
+	args = append(args, "--defaults", f.Name())
+	cleanup = func() { os.Remove(f.Name()) }
+
+	return
+}
+
+// metadataValue is same as --metadata, the repeated values are a list,
+// true and false are booleans
+func metadataValue(values []string) interface{} {
+	if len(values) > 1 {
+		return values
+	}
+
+	switch value := values[0]; value {
+	case "true", "false":
+		return value == "true"
+	default:
+		return value
+	}
+}
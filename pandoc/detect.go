@@ -0,0 +1,209 @@
+package pandoc
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the default reader of pandoc if nothing detected
+const defaultInputFormat = "markdown"
+
+var extensionFormats = map[string]string{
+	".md":       "markdown",
+	".markdown": "markdown",
+	".txt":      "markdown",
+	".html":     "html",
+	".htm":      "html",
+	".xhtml":    "html",
+	".tex":      "latex",
+	".latex":    "latex",
+	".docx":     "docx",
+	".odt":      "odt",
+	".epub":     "epub",
+	".ipynb":    "ipynb",
+	".rst":      "rst",
+	".org":      "org",
+	".textile":  "textile",
+	".rtf":      "rtf",
+	".csv":      "csv",
+	".tsv":      "tsv",
+	".dbk":      "docbook",
+	".fb2":      "fb2",
+	".opml":     "opml",
+	".typ":      "typst",
+	".wiki":     "mediawiki",
+	".adoc":     "asciidoc",
+	".json":     "json",
+}
+
+var contentTypeFormats = map[string]string{
+	"text/markdown":             "markdown",
+	"text/x-markdown":           "markdown",
+	"text/html":                 "html",
+	"application/xhtml+xml":     "html",
+	"application/x-latex":       "latex",
+	"application/x-tex":         "latex",
+	"text/x-tex":                "latex",
+	"text/x-rst":                "rst",
+	"text/x-org":                "org",
+	"text/csv":                  "csv",
+	"text/tab-separated-values": "tsv",
+	"application/rtf":           "rtf",
+	"text/rtf":                  "rtf",
+	"application/epub+zip":      "epub",
+	"application/x-ipynb+json":  "ipynb",
+	"application/docbook+xml":   "docbook",
+	"application/vnd.oasis.opendocument.text":                                 "odt",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+}
+
+// FormatByFilename returns the format of the extension of filename,
+// empty if the extension is unknown
+func FormatByFilename(filename string) string {
+	return extensionFormats[strings.ToLower(filepath.Ext(filename))]
+}
+
+// formatByContentType returns the format of the specific content type,
+// the generic types like text/plain are not detected
+func formatByContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return contentTypeFormats[mediaType]
+}
+
+// inputName returns the name of input file, the extension is the format,
+// or is detected by the content type and the filename from fetcher
+func inputName(name, from, contentType, filename string) string {
+	if len(from) > 0 {
+		return name + "." + from
+	}
+
+	if format := formatByContentType(contentType); len(format) > 0 {
+		return name + "." + format
+	}
+
+	if format := FormatByFilename(filename); len(format) > 0 {
+		return name + "." + format
+	}
+
+	return name
+}
+
+// detectFormat detects the pandoc reader of the input file by the magic
+// bytes of zip based formats, the extension, and the content, the
+// default format is markdown
+func detectFormat(filename string) (format string, err error) {
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	head, err := ioutil.ReadAll(io.LimitReader(f, 4096))
+	if err != nil {
+		return
+	}
+
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		if format = detectZipFormat(filename); len(format) > 0 {
+			return
+		}
+	}
+
+	if format = FormatByFilename(filename); len(format) > 0 {
+		return
+	}
+
+	// the extension is the format name if it is named by inputName
+	if format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), "."); len(format) > 0 && isKnownFormat(format) {
+		return
+	}
+
+	if format = sniffFormat(head); len(format) > 0 {
+		return
+	}
+
+	format = defaultInputFormat
+
+	return
+}
+
+func isKnownFormat(format string) bool {
+	for _, f := range extensionFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectZipFormat distinguishes docx, odt and epub by the entries
+func detectZipFormat(filename string) string {
+
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return ""
+	}
+
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		switch file.Name {
+		case "word/document.xml":
+			return "docx"
+		case "mimetype":
+			rc, err := file.Open()
+			if err != nil {
+				continue
+			}
+
+			mimetype, _ := ioutil.ReadAll(io.LimitReader(rc, 128))
+			rc.Close()
+
+			switch strings.TrimSpace(string(mimetype)) {
+			case "application/epub+zip":
+				return "epub"
+			case "application/vnd.oasis.opendocument.text":
+				return "odt"
+			}
+		}
+	}
+
+	return ""
+}
+
+// sniffFormat detects the text formats by the beginning of content
+func sniffFormat(head []byte) string {
+
+	text := bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	lower := bytes.ToLower(text)
+
+	switch {
+	case bytes.HasPrefix(text, []byte(`{\rtf`)):
+		return "rtf"
+	case bytes.HasPrefix(lower, []byte("<!doctype html")),
+		bytes.HasPrefix(lower, []byte("<html")),
+		bytes.HasPrefix(lower, []byte("<?xml")) && bytes.Contains(lower, []byte("<html")):
+		return "html"
+	case bytes.HasPrefix(text, []byte("{")) && bytes.Contains(text, []byte(`"cells"`)) &&
+		(bytes.Contains(text, []byte(`"nbformat"`)) || bytes.Contains(text, []byte(`"cell_type"`))):
+		return "ipynb"
+	case bytes.Contains(text, []byte(`\documentclass`)),
+		bytes.Contains(text, []byte(`\begin{document}`)):
+		return "latex"
+	}
+
+	return ""
+}
@@ -0,0 +1,155 @@
+package pandoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+// ErrorType is the machine-readable class of the conversion errors
+type ErrorType string
+
+const (
+	ErrorTypeInvalid      ErrorType = "invalid"    // the request is invalid, e.g. the fetcher not exist
+	ErrorTypeValidation   ErrorType = "validation" // the converter options are invalid
+	ErrorTypeFetch        ErrorType = "fetch"
+	ErrorTypeTimeout      ErrorType = "timeout"
+	ErrorTypeCanceled     ErrorType = "canceled"
+	ErrorTypePandoc       ErrorType = "pandoc" // pandoc exits with non zero code
+	ErrorTypeLatex        ErrorType = "latex"  // the pdf engine failed
+	ErrorTypeTooLarge     ErrorType = "too_large"
+	ErrorTypeQueueFull    ErrorType = "queue_full"
+	ErrorTypeQueueTimeout ErrorType = "queue_timeout"
+)
+
+// the exit code of pandoc if the pdf engine failed
+const exitCodePDFError = 43
+
+// FetchError is returned when the fetcher failed
+type FetchError struct {
+	Fetcher string
+	Err     error
+}
+
+func (p *FetchError) Error() string {
+	return fmt.Sprintf("fetch by %s failure, error: %s", p.Fetcher, p.Err)
+}
+
+func (p *FetchError) Unwrap() error {
+	return p.Err
+}
+
+// TimeoutError is returned when pandoc is killed after the timeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (p *TimeoutError) Error() string {
+	return fmt.Sprintf("execute timeout, the limit is %s", p.Timeout)
+}
+
+// ExitError is returned when pandoc exits with non zero code
+type ExitError struct {
+	Code   int
+	Stderr string
+}
+
+func (p *ExitError) Error() string {
+	if stderr := strings.TrimSpace(p.Stderr); len(stderr) > 0 {
+		return stderr
+	}
+
+	return fmt.Sprintf("pandoc exit with code %d", p.Code)
+}
+
+// LatexError is returned when the pdf engine failed, the Log is the
+// excerpt of latex log from the first error
+type LatexError struct {
+	*ExitError
+	Engine string
+	Log    string
+}
+
+func (p *LatexError) Error() string {
+	return fmt.Sprintf("%s failure, %s", p.Engine, p.Log)
+}
+
+func (p *LatexError) Unwrap() error {
+	return p.ExitError
+}
+
+// latexError returns a LatexError if the pdf engine failed, otherwise err
+func latexError(err error, engine string) error {
+	exitErr, ok := err.(*ExitError)
+	if !ok || (exitErr.Code != exitCodePDFError && !strings.Contains(exitErr.Stderr, "Error producing PDF")) {
+		return err
+	}
+
+	if len(engine) == 0 {
+		engine = "pdf engine"
+	}
+
+	return &LatexError{ExitError: exitErr, Engine: engine, Log: latexLog(exitErr.Stderr)}
+}
+
+// latexLog returns the lines from the first latex error, e.g. ! Undefined control sequence,
+// or the last lines if no error line found
+func latexLog(stderr string) string {
+	const maxLines = 10
+
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, "!") {
+			lines = lines[i:]
+			if len(lines) > maxLines {
+				lines = lines[:maxLines]
+			}
+			return strings.Join(lines, "\n")
+		}
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ErrorTypeOf returns the class of the conversion error
+func ErrorTypeOf(err error) ErrorType {
+
+	var (
+		latexErr   *LatexError
+		exitErr    *ExitError
+		timeoutErr *TimeoutError
+		fetchErr   *FetchError
+	)
+
+	switch {
+	case fetcher.IsPayloadTooLarge(err):
+		return ErrorTypeTooLarge
+	case IsValidationError(err):
+		return ErrorTypeValidation
+	case err == ErrQueueFull:
+		return ErrorTypeQueueFull
+	case err == ErrQueueTimeout:
+		return ErrorTypeQueueTimeout
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	case errors.As(err, &fetchErr):
+		return ErrorTypeFetch
+	case errors.As(err, &latexErr):
+		return ErrorTypeLatex
+	case errors.As(err, &exitErr):
+		return ErrorTypePandoc
+	}
+
+	return ErrorTypeInvalid
+}
@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+	"github.com/gogap/go-pandoc/pandoc/netguard"
+)
+
+type ArchiveFetcher struct {
+	client *http.Client
+	limits Limits
+}
+
+type Params struct {
+	Data    []byte   `json:"data"`
+	URL     string   `json:"url"`
+	Format  string   `json:"format"` // zip|tar.gz, detected by url or data if empty
+	Entry   string   `json:"entry"`
+	Entries []string `json:"entries"`
+}
+
+func (p *Params) Validation() (err error) {
+	if len(p.Data) == 0 && len(p.URL) == 0 {
+		err = fmt.Errorf("[fetcher-archive]: params of data and url are both empty")
+		return
+	}
+
+	if len(p.Entry) > 0 {
+		p.Entries = append([]string{p.Entry}, p.Entries...)
+	}
+
+	if len(p.Entries) == 0 {
+		err = fmt.Errorf("[fetcher-archive]: params of entry is empty")
+		return
+	}
+
+	p.Format = strings.ToLower(p.Format)
+
+	if len(p.Format) == 0 {
+		p.Format = detectFormat(p.URL, p.Data)
+	}
+
+	if p.Format != FormatZip && p.Format != FormatTarGz {
+		err = fmt.Errorf("[fetcher-archive]: format %s not support", p.Format)
+		return
+	}
+
+	return
+}
+
+func init() {
+	err := fetcher.RegisterFetcher("archive", NewArchiveFetcher)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewArchiveFetcher(conf config.Configuration) (archiveFetcher fetcher.Fetcher, err error) {
+
+	limits := DefaultLimits
+	var networkConf config.Configuration
+
+	if conf != nil {
+		limits.MaxSize = conf.GetInt64("max-size", limits.MaxSize)
+		limits.MaxFiles = int(conf.GetInt32("max-files", int32(limits.MaxFiles)))
+		networkConf = conf.GetConfig("network")
+	}
+
+	policy, err := netguard.NewPolicy(networkConf)
+	if err != nil {
+		return
+	}
+
+	archiveFetcher = &ArchiveFetcher{
+		client: policy.NewClient(),
+		limits: limits,
+	}
+
+	return
+}
+
+func (p *ArchiveFetcher) Fetch(fetchParams fetcher.FetchParams) (data []byte, err error) {
+	err = fmt.Errorf("[fetcher-archive]: the archive should be fetched into dir")
+	return
+}
+
+func (p *ArchiveFetcher) FetchDir(ctx context.Context, fetchParams fetcher.FetchParams, dir string) (inputs []string, err error) {
+
+	params := Params{}
+
+	err = fetchParams.Unmarshal(&params)
+	if err != nil {
+		return
+	}
+
+	err = params.Validation()
+	if err != nil {
+		return
+	}
+
+	data := params.Data
+
+	if len(data) == 0 {
+		data, err = p.download(ctx, params.URL)
+		if err != nil {
+			return
+		}
+	}
+
+	switch params.Format {
+	case FormatZip:
+		err = ExtractZip(data, dir, p.limits)
+	case FormatTarGz:
+		err = ExtractTarGz(bytes.NewReader(data), dir, p.limits)
+	}
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range params.Entries {
+		name, e := SecurePath(dir, entry)
+		if e != nil {
+			err = e
+			return
+		}
+
+		fi, e := os.Stat(name)
+		if e != nil || !fi.Mode().IsRegular() {
+			err = fmt.Errorf("[fetcher-archive]: entry %s not exist", entry)
+			return
+		}
+
+		rel, _ := filepath.Rel(dir, name)
+		inputs = append(inputs, rel)
+	}
+
+	return
+}
+
+func (p *ArchiveFetcher) download(ctx context.Context, url string) (data []byte, err error) {
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("[fetcher-archive]: download archive failure <%s>, status code is %d", url, resp.StatusCode)
+		return
+	}
+
+	// the archive could not be larger than the extracted files
+	data, err = fetcher.ReadAll(resp.Body, p.limits.MaxSize, "[fetcher-archive]: archive")
+
+	return
+}
+
+func detectFormat(url string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return FormatZip
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return FormatTarGz
+	case strings.HasSuffix(url, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		return FormatTarGz
+	}
+
+	return ""
+}
@@ -0,0 +1,222 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// Limits protects the extraction from archive bombs
+type Limits struct {
+	MaxSize  int64 // total bytes of the extracted files
+	MaxFiles int   // the entries, including the dirs and the skipped symlinks
+}
+
+var DefaultLimits = Limits{
+	MaxSize:  100 << 20,
+	MaxFiles: 1000,
+}
+
+// SecurePath joins the name to dir, and returns error if the result
+// is not in dir, e.g. the name is absolute or contains '..'
+func SecurePath(dir, name string) (fname string, err error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		err = fmt.Errorf("path %s is absolute", name)
+		return
+	}
+
+	fname = filepath.Join(dir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(dir, fname)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("path %s is not in dir", name)
+		return
+	}
+
+	return
+}
+
+type extractor struct {
+	dir    string
+	limits Limits
+
+	size  int64
+	files int
+}
+
+// count counts the entry, so neither the files nor the empty dirs could
+// exhaust the inodes
+func (p *extractor) count() (err error) {
+	p.files++
+	if p.limits.MaxFiles > 0 && p.files > p.limits.MaxFiles {
+		err = fmt.Errorf("too many entries in archive, the limit is %d", p.limits.MaxFiles)
+		return
+	}
+
+	return
+}
+
+func (p *extractor) mkdir(name string) (err error) {
+	err = p.count()
+	if err != nil {
+		return
+	}
+
+	fname, err := SecurePath(p.dir, name)
+	if err != nil {
+		return
+	}
+
+	return os.MkdirAll(fname, 0755)
+}
+
+func (p *extractor) writeFile(name string, r io.Reader) (err error) {
+
+	err = p.count()
+	if err != nil {
+		return
+	}
+
+	fname, err := SecurePath(p.dir, name)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(fname, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	if p.limits.MaxSize > 0 {
+		r = io.LimitReader(r, p.limits.MaxSize-p.size+1)
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return
+	}
+
+	p.size += n
+
+	if p.limits.MaxSize > 0 && p.size > p.limits.MaxSize {
+		err = &fetcher.PayloadTooLargeError{Payload: "extracted files of archive", Limit: p.limits.MaxSize}
+		return
+	}
+
+	return
+}
+
+// ExtractZip extracts the regular files and dirs of zip data into dir,
+// the symlinks are ignored
+func ExtractZip(data []byte, dir string, limits Limits) (err error) {
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+
+	ex := &extractor{dir: dir, limits: limits}
+
+	for _, zf := range zr.File {
+
+		mode := zf.Mode()
+
+		if mode.IsDir() {
+			err = ex.mkdir(zf.Name)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if !mode.IsRegular() {
+			err = ex.count()
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		var rc io.ReadCloser
+		rc, err = zf.Open()
+		if err != nil {
+			return
+		}
+
+		err = ex.writeFile(zf.Name, rc)
+		rc.Close()
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ExtractTarGz extracts the gzipped tar stream into dir
+func ExtractTarGz(r io.Reader, dir string, limits Limits) (err error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+
+	defer gr.Close()
+
+	return ExtractTar(gr, dir, limits)
+}
+
+// ExtractTar extracts the regular files and dirs of tar stream into dir,
+// the symlinks and the other special files are ignored
+func ExtractTar(r io.Reader, dir string, limits Limits) (err error) {
+
+	tr := tar.NewReader(r)
+
+	ex := &extractor{dir: dir, limits: limits}
+
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = ex.mkdir(hdr.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = ex.writeFile(hdr.Name, tr)
+		default:
+			err = ex.count()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
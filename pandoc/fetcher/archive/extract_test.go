@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+type entry struct {
+	name string
+	data string
+	link string // the target if it is a symlink
+	dir  bool
+}
+
+func zipData(t *testing.T, entries []entry) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name}
+		data := e.data
+
+		if len(e.link) > 0 {
+			hdr.SetMode(os.ModeSymlink | 0777)
+			data = e.link
+		}
+
+		if e.dir {
+			hdr.Name += "/"
+			hdr.SetMode(os.ModeDir | 0755)
+		}
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Write([]byte(data))
+	}
+
+	zw.Close()
+
+	return buf.Bytes()
+}
+
+func tarGzData(t *testing.T, entries []entry) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+
+		if len(e.link) > 0 {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Linkname: e.link, Typeflag: tar.TypeSymlink}
+		}
+
+		if e.dir {
+			hdr = &tar.Header{Name: e.name + "/", Mode: 0755, Typeflag: tar.TypeDir}
+		}
+
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tw.Write([]byte(e.data))
+	}
+
+	tw.Close()
+	gw.Close()
+
+	return buf.Bytes()
+}
+
+func TestSecurePath(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "archive")
+
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"docs/main.md", true},
+		{"./docs/../main.md", true},
+		{"..", false},
+		{"../evil", false},
+		{"docs/../../evil", false},
+		{"/etc/passwd", false},
+		{"..evil", true},
+	}
+
+	for _, test := range tests {
+		_, err := SecurePath(dir, test.name)
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	limits := Limits{MaxSize: 100, MaxFiles: 3}
+
+	tests := []struct {
+		desc     string
+		entries  []entry
+		valid    bool
+		tooLarge bool
+	}{
+		{"regular", []entry{{name: "docs/main.md", data: "# main"}, {name: "docs/img/a.png", data: "png"}}, true, false},
+		{"parent", []entry{{name: "../evil.md", data: "evil"}}, false, false},
+		{"nested parent", []entry{{name: "docs/../../evil.md", data: "evil"}}, false, false},
+		{"absolute", []entry{{name: "/evil.md", data: "evil"}}, false, false},
+		{"symlink", []entry{{name: "link", link: ".."}, {name: "main.md", data: "# main"}}, true, false},
+		{"too large", []entry{{name: "a.md", data: string(make([]byte, 60))}, {name: "b.md", data: string(make([]byte, 60))}}, false, true},
+		{"too many", []entry{{name: "a.md"}, {name: "b.md"}, {name: "c.md"}, {name: "d.md"}}, false, false},
+		{"dirs", []entry{{name: "docs", dir: true}, {name: "docs/main.md"}, {name: "img", dir: true}}, true, false},
+		{"too many dirs", []entry{{name: "a", dir: true}, {name: "b", dir: true}, {name: "c", dir: true}, {name: "d", dir: true}}, false, false},
+		{"too many symlinks", []entry{{name: "a", link: "x"}, {name: "b", link: "x"}, {name: "c", link: "x"}, {name: "d", link: "x"}}, false, false},
+	}
+
+	extracts := map[string]func(data []byte, dir string) error{
+		"zip": func(data []byte, dir string) error {
+			return ExtractZip(data, dir, limits)
+		},
+		"tar.gz": func(data []byte, dir string) error {
+			return ExtractTarGz(bytes.NewReader(data), dir, limits)
+		},
+	}
+
+	for format, extract := range extracts {
+		for _, test := range tests {
+			data := zipData(t, test.entries)
+			if format == "tar.gz" {
+				data = tarGzData(t, test.entries)
+			}
+
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "dir")
+
+			err := extract(data, dir)
+			if (err == nil) != test.valid || fetcher.IsPayloadTooLarge(err) != test.tooLarge {
+				t.Fatalf("%s %s: unexpected error: %v", format, test.desc, err)
+			}
+
+			if _, err := os.Stat(filepath.Join(parent, "evil.md")); err == nil {
+				t.Fatalf("%s %s: the file is written out of dir", format, test.desc)
+			}
+
+			if _, err := os.Lstat(filepath.Join(dir, "link")); err == nil {
+				t.Fatalf("%s %s: the symlink should be ignored", format, test.desc)
+			}
+		}
+	}
+}
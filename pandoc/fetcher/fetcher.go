@@ -1,6 +1,7 @@
 package fetcher
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -11,6 +12,34 @@ type Fetcher interface {
 	Fetch(FetchParams) ([]byte, error)
 }
 
+// ContextFetcher is a Fetcher which could be cancelled by the context
+type ContextFetcher interface {
+	Fetcher
+	FetchContext(context.Context, FetchParams) ([]byte, error)
+}
+
+// DirFetcher fetches a multi-file project into dir, e.g. from an archive,
+// and returns the input files relative to dir in order
+type DirFetcher interface {
+	Fetcher
+	FetchDir(ctx context.Context, params FetchParams, dir string) (inputs []string, err error)
+}
+
+// Fetch calls FetchContext if the fetcher is a ContextFetcher,
+// otherwise it calls Fetch and only checks the context before
+func Fetch(ctx context.Context, f Fetcher, params FetchParams) (data []byte, err error) {
+	if cf, ok := f.(ContextFetcher); ok {
+		return cf.FetchContext(ctx, params)
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
+
+	return f.Fetch(params)
+}
+
 type FetchParams []byte
 
 func (p *FetchParams) Unmarshal(v interface{}) (err error) {
@@ -0,0 +1,343 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+type FileFetcher struct {
+	root     string // the real path of root dir, symlinks are resolved
+	maxSize  int64
+	maxFiles int
+}
+
+type Params struct {
+	Path      string   `json:"path"`      // relative path or glob of the input files
+	Resources []string `json:"resources"` // globs of the files referenced by inputs, e.g. images
+}
+
+func (p *Params) Validation() (err error) {
+	if len(p.Path) == 0 {
+		err = fmt.Errorf("[fetcher-file]: params of path is empty")
+		return
+	}
+
+	return
+}
+
+func init() {
+	err := fetcher.RegisterFetcher("file", NewFileFetcher)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewFileFetcher(conf config.Configuration) (fileFetcher fetcher.Fetcher, err error) {
+
+	if conf == nil || len(conf.GetString("root")) == 0 {
+		err = fmt.Errorf("[fetcher-file]: options of root is empty")
+		return
+	}
+
+	root, err := filepath.Abs(conf.GetString("root"))
+	if err != nil {
+		return
+	}
+
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		err = fmt.Errorf("[fetcher-file]: root dir is invalid, error: %s", err)
+		return
+	}
+
+	fileFetcher = &FileFetcher{
+		root:     root,
+		maxSize:  conf.GetInt64("max-size", 100<<20),
+		maxFiles: int(conf.GetInt32("max-files", 1000)),
+	}
+
+	return
+}
+
+// Fetch reads the file of path, the glob should match only one file
+func (p *FileFetcher) Fetch(fetchParams fetcher.FetchParams) (data []byte, err error) {
+
+	rc, _, err := p.FetchStream(context.Background(), fetchParams)
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// FetchStream opens the file of path, the glob should match only one file
+func (p *FileFetcher) FetchStream(ctx context.Context, fetchParams fetcher.FetchParams) (rc io.ReadCloser, meta fetcher.Metadata, err error) {
+
+	params := Params{}
+
+	err = fetchParams.Unmarshal(&params)
+	if err != nil {
+		return
+	}
+
+	err = params.Validation()
+	if err != nil {
+		return
+	}
+
+	files, err := p.match(params.Path)
+	if err != nil {
+		return
+	}
+
+	if len(files) != 1 {
+		err = fmt.Errorf("[fetcher-file]: path %s matched %d files, expect 1", params.Path, len(files))
+		return
+	}
+
+	f, fi, err := p.open(files[0])
+	if err != nil {
+		return
+	}
+
+	if p.maxSize > 0 && fi.Size() > p.maxSize {
+		f.Close()
+		err = &fetcher.PayloadTooLargeError{Payload: "[fetcher-file]: file", Limit: p.maxSize}
+		return
+	}
+
+	rc = struct {
+		io.Reader
+		io.Closer
+	}{fetcher.LimitReader(f, p.maxSize, "[fetcher-file]: file"), f}
+
+	meta = fetcher.Metadata{
+		ContentType: mime.TypeByExtension(filepath.Ext(files[0])),
+		Filename:    filepath.Base(files[0]),
+		Size:        fi.Size(),
+	}
+
+	return
+}
+
+// FetchDir copies the matched files and resources into dir with the paths
+// relative to root, the files matched by path are the inputs in order
+func (p *FileFetcher) FetchDir(ctx context.Context, fetchParams fetcher.FetchParams, dir string) (inputs []string, err error) {
+
+	params := Params{}
+
+	err = fetchParams.Unmarshal(&params)
+	if err != nil {
+		return
+	}
+
+	err = params.Validation()
+	if err != nil {
+		return
+	}
+
+	inputs, err = p.match(params.Path)
+	if err != nil {
+		return
+	}
+
+	if len(inputs) == 0 {
+		err = fmt.Errorf("[fetcher-file]: no file matched by %s", params.Path)
+		return
+	}
+
+	files := inputs
+
+	for _, pattern := range params.Resources {
+		var resources []string
+		resources, err = p.match(pattern)
+		if err != nil {
+			return
+		}
+
+		files = append(files, resources...)
+	}
+
+	if p.maxFiles > 0 && len(files) > p.maxFiles {
+		err = fmt.Errorf("[fetcher-file]: too many files, the limit is %d", p.maxFiles)
+		return
+	}
+
+	var size int64
+
+	for _, name := range files {
+		fi, e := os.Stat(filepath.Join(p.root, name))
+		if e != nil {
+			err = e
+			return
+		}
+
+		size += fi.Size()
+	}
+
+	if p.maxSize > 0 && size > p.maxSize {
+		err = &fetcher.PayloadTooLargeError{Payload: "[fetcher-file]: files", Limit: p.maxSize}
+		return
+	}
+
+	for _, name := range files {
+		err = ctx.Err()
+		if err != nil {
+			return
+		}
+
+		err = p.copyFile(name, dir)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// match returns the regular files matched by the pattern, relative to root,
+// the matches out of root are rejected, including the symlinks to outside
+func (p *FileFetcher) match(pattern string) (files []string, err error) {
+
+	pattern = filepath.FromSlash(pattern)
+
+	if filepath.IsAbs(pattern) {
+		err = fmt.Errorf("[fetcher-file]: path %s should be relative", pattern)
+		return
+	}
+
+	if !inDir(p.root, filepath.Join(p.root, pattern)) {
+		err = fmt.Errorf("[fetcher-file]: path %s is not in root dir", pattern)
+		return
+	}
+
+	matches, err := filepath.Glob(filepath.Join(p.root, pattern))
+	if err != nil {
+		err = fmt.Errorf("[fetcher-file]: path %s is invalid, error: %s", pattern, err)
+		return
+	}
+
+	sort.Strings(matches)
+
+	for _, match := range matches {
+		realPath, e := filepath.EvalSymlinks(match)
+		if e != nil {
+			err = fmt.Errorf("[fetcher-file]: resolve path failure, error: %s", e)
+			return
+		}
+
+		if !inDir(p.root, realPath) {
+			err = fmt.Errorf("[fetcher-file]: path %s is not in root dir", pattern)
+			return
+		}
+
+		fi, e := os.Stat(realPath)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		rel, _ := filepath.Rel(p.root, realPath)
+		files = append(files, rel)
+	}
+
+	return
+}
+
+// copyFile copies the file relative to root into dir, the file is still
+// limited while copying in case it grows after checked
+func (p *FileFetcher) copyFile(name, dir string) (err error) {
+
+	src, _, err := p.open(name)
+	if err != nil {
+		return
+	}
+
+	defer src.Close()
+
+	fname := filepath.Join(dir, name)
+
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return
+	}
+
+	dst, err := os.Create(fname)
+	if err != nil {
+		return
+	}
+
+	defer dst.Close()
+
+	_, err = io.Copy(dst, fetcher.LimitReader(src, p.maxSize, "[fetcher-file]: files"))
+
+	return
+}
+
+// open opens the file relative to root, the path is checked again after
+// opening, so the file replaced by a symlink to outside after matched,
+// including by its parent dirs, is rejected
+func (p *FileFetcher) open(name string) (f *os.File, fi os.FileInfo, err error) {
+
+	fname := filepath.Join(p.root, name)
+
+	f, err = os.Open(fname)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close()
+			f = nil
+		}
+	}()
+
+	fi, err = f.Stat()
+	if err != nil {
+		return
+	}
+
+	lfi, err := os.Lstat(fname)
+	if err != nil {
+		return
+	}
+
+	realPath, err := filepath.EvalSymlinks(fname)
+	if err != nil {
+		return
+	}
+
+	if !fi.Mode().IsRegular() || !os.SameFile(fi, lfi) || realPath != fname {
+		err = fmt.Errorf("[fetcher-file]: path %s is changed after matched", name)
+		return
+	}
+
+	return
+}
+
+func inDir(dir, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,137 @@
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+func newTestFetcher(t *testing.T) (f *FileFetcher, root, outside string) {
+	root = t.TempDir()
+	outside = t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(root, "docs", "a.md"):    "a",
+		filepath.Join(root, "docs", "b.md"):    "b",
+		filepath.Join(outside, "secret.md"):    "secret",
+		filepath.Join(outside, "docs", "a.md"): "outside",
+	}
+
+	for name, data := range files {
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(name, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Symlink(filepath.Join(outside, "secret.md"), filepath.Join(root, "link.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ff, err := NewFileFetcher(config.NewConfig(config.ConfigString(`root = "` + root + `"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ = filepath.EvalSymlinks(root)
+
+	return ff.(*FileFetcher), root, outside
+}
+
+func TestFileFetch(t *testing.T) {
+	f, _, _ := newTestFetcher(t)
+
+	tests := []struct {
+		params string
+		data   string // empty if rejected
+	}{
+		{`{"path": "docs/a.md"}`, "a"},
+		{`{"path": "docs/b.*"}`, "b"},
+		{`{"path": "docs/*.md"}`, ""},
+		{`{"path": "../secret.md"}`, ""},
+		{`{"path": "docs/../../secret.md"}`, ""},
+		{`{"path": "/etc/passwd"}`, ""},
+		{`{"path": "link.md"}`, ""},
+	}
+
+	for _, test := range tests {
+		data, err := f.Fetch(fetcher.FetchParams(test.params))
+
+		if len(test.data) == 0 && err == nil {
+			t.Fatalf("%s should be rejected", test.params)
+		}
+
+		if len(test.data) > 0 && (err != nil || string(data) != test.data) {
+			t.Fatalf("%s: unexpected data %q, error: %v", test.params, data, err)
+		}
+	}
+}
+
+func TestFileFetchDir(t *testing.T) {
+	f, _, _ := newTestFetcher(t)
+
+	dir := t.TempDir()
+
+	inputs, err := f.FetchDir(context.Background(), fetcher.FetchParams(`{"path": "docs/*.md"}`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inputs) != 2 || inputs[0] != filepath.Join("docs", "a.md") || inputs[1] != filepath.Join("docs", "b.md") {
+		t.Fatalf("unexpected inputs: %v", inputs)
+	}
+
+	_, err = f.FetchDir(context.Background(), fetcher.FetchParams(`{"path": "docs/a.md", "resources": ["*.md"]}`), t.TempDir())
+	if err == nil {
+		t.Fatalf("the symlink to outside should be rejected")
+	}
+}
+
+// the files are replaced by symlinks to outside after matched
+func TestFileOpenReplaced(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace func(root, outside string) error
+	}{
+		{"file", func(root, outside string) error {
+			fname := filepath.Join(root, "docs", "a.md")
+			os.Remove(fname)
+			return os.Symlink(filepath.Join(outside, "secret.md"), fname)
+		}},
+		{"dir", func(root, outside string) error {
+			os.RemoveAll(filepath.Join(root, "docs"))
+			return os.Symlink(filepath.Join(outside, "docs"), filepath.Join(root, "docs"))
+		}},
+	}
+
+	for _, test := range tests {
+		f, root, outside := newTestFetcher(t)
+
+		files, err := f.match("docs/a.md")
+		if err != nil || len(files) != 1 {
+			t.Fatalf("%s: unexpected matches %v, error: %v", test.name, files, err)
+		}
+
+		err = test.replace(root, outside)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, _, err := f.open(files[0])
+		if err == nil {
+			file.Close()
+			t.Fatalf("%s: the replaced file should be rejected", test.name)
+		}
+	}
+}
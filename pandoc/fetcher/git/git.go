@@ -0,0 +1,250 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+	"github.com/gogap/go-pandoc/pandoc/fetcher/archive"
+)
+
+type GitFetcher struct {
+	repos   map[string]*repository
+	timeout time.Duration
+	limits  archive.Limits
+}
+
+type Params struct {
+	Repo    string   `json:"repo"`    // the name of repo in options
+	Ref     string   `json:"ref"`     // branch, tag or commit, default is HEAD
+	Path    string   `json:"path"`    // the file, or the subtree if entries is not empty
+	Entries []string `json:"entries"` // the input files relative to path in order
+}
+
+func (p *Params) Validation() (err error) {
+	if len(p.Repo) == 0 {
+		err = fmt.Errorf("[fetcher-git]: params of repo is empty")
+		return
+	}
+
+	if len(p.Ref) == 0 {
+		p.Ref = "HEAD"
+	}
+
+	if strings.HasPrefix(p.Ref, "-") || strings.ContainsAny(p.Ref, " :^~\\") {
+		err = fmt.Errorf("[fetcher-git]: params of ref %s is invalid", p.Ref)
+		return
+	}
+
+	p.Path, err = cleanPath(p.Path)
+	if err != nil {
+		return
+	}
+
+	if len(p.Path) == 0 && len(p.Entries) == 0 {
+		err = fmt.Errorf("[fetcher-git]: params of path and entries are both empty")
+		return
+	}
+
+	for i, entry := range p.Entries {
+		entry, err = cleanPath(entry)
+		if err != nil {
+			return
+		}
+
+		if len(entry) == 0 {
+			err = fmt.Errorf("[fetcher-git]: params of entries contains empty path")
+			return
+		}
+
+		p.Entries[i] = path.Join(p.Path, entry)
+	}
+
+	return
+}
+
+// cleanPath returns the slash path relative to the root of repo
+func cleanPath(name string) (cleaned string, err error) {
+	name = filepath.ToSlash(name)
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			err = fmt.Errorf("[fetcher-git]: path %s should not contain '..'", name)
+			return
+		}
+	}
+
+	cleaned = strings.Trim(path.Clean("/"+name), "/")
+
+	return
+}
+
+func init() {
+	err := fetcher.RegisterFetcher("git", NewGitFetcher)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewGitFetcher(conf config.Configuration) (gitFetcher fetcher.Fetcher, err error) {
+
+	if conf == nil || conf.GetConfig("repos") == nil {
+		err = fmt.Errorf("[fetcher-git]: options of repos is empty")
+		return
+	}
+
+	cacheDir := conf.GetString("cache-dir", filepath.Join(os.TempDir(), "go-pandoc-git"))
+	fetchInterval := conf.GetTimeDuration("fetch-interval", time.Minute)
+
+	f := &GitFetcher{
+		repos:   make(map[string]*repository),
+		timeout: conf.GetTimeDuration("timeout", time.Minute*2),
+		limits:  archive.DefaultLimits,
+	}
+
+	f.limits.MaxSize = conf.GetInt64("max-size", f.limits.MaxSize)
+	f.limits.MaxFiles = int(conf.GetInt32("max-files", int32(f.limits.MaxFiles)))
+
+	reposConf := conf.GetConfig("repos")
+
+	for _, name := range reposConf.Keys() {
+		url := reposConf.GetString(name + ".url")
+		if len(url) == 0 {
+			err = fmt.Errorf("[fetcher-git]: url of repo %s is empty", name)
+			return
+		}
+
+		f.repos[name] = newRepository(cacheDir, url, fetchInterval)
+	}
+
+	gitFetcher = f
+
+	return
+}
+
+// Fetch returns the content of the file of path
+func (p *GitFetcher) Fetch(fetchParams fetcher.FetchParams) (data []byte, err error) {
+	return p.FetchContext(context.Background(), fetchParams)
+}
+
+func (p *GitFetcher) FetchContext(ctx context.Context, fetchParams fetcher.FetchParams) (data []byte, err error) {
+
+	dir, err := ioutil.TempDir("", "go-pandoc-git")
+	if err != nil {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	inputs, err := p.FetchDir(ctx, fetchParams, dir)
+	if err != nil {
+		return
+	}
+
+	if len(inputs) != 1 {
+		err = fmt.Errorf("[fetcher-git]: only one file could be fetched, but got %d", len(inputs))
+		return
+	}
+
+	f, err := os.Open(filepath.Join(dir, inputs[0]))
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	data, err = fetcher.ReadAll(f, p.limits.MaxSize, "[fetcher-git]: file")
+
+	return
+}
+
+// FetchDir extracts the path at ref into dir, keeps the paths relative to
+// the root of repo, the inputs are the path or the entries
+func (p *GitFetcher) FetchDir(ctx context.Context, fetchParams fetcher.FetchParams, dir string) (inputs []string, err error) {
+
+	params := Params{}
+
+	err = fetchParams.Unmarshal(&params)
+	if err != nil {
+		return
+	}
+
+	err = params.Validation()
+	if err != nil {
+		return
+	}
+
+	repo, exist := p.repos[params.Repo]
+	if !exist {
+		err = fmt.Errorf("[fetcher-git]: repo %s not exist", params.Repo)
+		return
+	}
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	commit, err := repo.resolve(ctx, params.Ref)
+	if err != nil {
+		return
+	}
+
+	r, w := io.Pipe()
+
+	archiveErr := make(chan error, 1)
+
+	go func() {
+		e := repo.archive(ctx, commit, params.Path, w)
+		w.CloseWithError(e)
+		archiveErr <- e
+	}()
+
+	err = archive.ExtractTar(r, dir, p.limits)
+
+	if err == nil {
+		// the padding after the end of tar
+		_, err = io.Copy(ioutil.Discard, r)
+	}
+
+	// stop git archive if the extraction is failed
+	r.CloseWithError(err)
+
+	if e := <-archiveErr; err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return
+	}
+
+	inputs = params.Entries
+
+	if len(inputs) == 0 {
+		inputs = []string{params.Path}
+	}
+
+	for i, input := range inputs {
+		name := filepath.Join(dir, filepath.FromSlash(input))
+
+		fi, e := os.Stat(name)
+		if e != nil || !fi.Mode().IsRegular() {
+			err = fmt.Errorf("[fetcher-git]: file %s not exist at %s", input, params.Ref)
+			return
+		}
+
+		inputs[i] = filepath.FromSlash(input)
+	}
+
+	return
+}
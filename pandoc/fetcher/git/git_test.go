@@ -0,0 +1,203 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+// testRepo is a work tree pushing to a bare remote
+type testRepo struct {
+	t      *testing.T
+	work   string
+	remote string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	base := t.TempDir()
+
+	repo := &testRepo{
+		t:      t,
+		work:   filepath.Join(base, "work"),
+		remote: filepath.Join(base, "remote.git"),
+	}
+
+	repo.git(base, "init", "--quiet", "--bare", repo.remote)
+	repo.git(repo.remote, "symbolic-ref", "HEAD", "refs/heads/main")
+	repo.git(base, "init", "--quiet", repo.work)
+	repo.git(repo.work, "checkout", "--quiet", "-b", "main")
+
+	return repo
+}
+
+func (p *testRepo) git(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(gitEnv(),
+		"GIT_AUTHOR_NAME=go-pandoc", "GIT_AUTHOR_EMAIL=go-pandoc@example.com",
+		"GIT_COMMITTER_NAME=go-pandoc", "GIT_COMMITTER_EMAIL=go-pandoc@example.com",
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		p.t.Fatalf("git %v failure, error: %s, %s", args, err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes the files, pushes main and returns the commit
+func (p *testRepo) commit(files map[string]string) string {
+	for name, data := range files {
+		fname := filepath.Join(p.work, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(fname), 0755)
+		if err != nil {
+			p.t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(fname, []byte(data), 0644)
+		if err != nil {
+			p.t.Fatal(err)
+		}
+	}
+
+	p.git(p.work, "add", ".")
+	p.git(p.work, "commit", "--quiet", "-m", "update")
+	p.git(p.work, "push", "--quiet", "--tags", p.remote, "main")
+
+	return p.git(p.work, "rev-parse", "HEAD")
+}
+
+func (p *testRepo) fetcher(fetchInterval string) *GitFetcher {
+	conf := config.NewConfig(config.ConfigString(fmt.Sprintf(`
+		cache-dir      = "%s"
+		fetch-interval = %s
+		repos {
+			docs {
+				url = "%s"
+			}
+		}
+	`, p.t.TempDir(), fetchInterval, p.remote)))
+
+	f, err := NewGitFetcher(conf)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	return f.(*GitFetcher)
+}
+
+func TestGitFetchRef(t *testing.T) {
+	repo := newTestRepo(t)
+
+	v1 := repo.commit(map[string]string{"docs/readme.md": "v1", "docs/images/logo.png": "png"})
+	repo.git(repo.work, "tag", "v1")
+	repo.commit(map[string]string{"docs/readme.md": "v2"})
+
+	f := repo.fetcher("1m")
+
+	tests := []struct {
+		params string
+		data   string
+	}{
+		{`{"repo": "docs", "path": "docs/readme.md"}`, "v2"},
+		{`{"repo": "docs", "ref": "main", "path": "docs/readme.md"}`, "v2"},
+		{`{"repo": "docs", "ref": "v1", "path": "docs/readme.md"}`, "v1"},
+		{`{"repo": "docs", "ref": "` + v1 + `", "path": "/docs/./readme.md"}`, "v1"},
+		{`{"repo": "docs", "ref": "` + v1[:10] + `", "path": "docs/readme.md"}`, "v1"},
+	}
+
+	for _, test := range tests {
+		data, err := f.Fetch(fetcher.FetchParams(test.params))
+		if err != nil || string(data) != test.data {
+			t.Fatalf("params %s, data: %q, error: %v", test.params, data, err)
+		}
+	}
+
+	dir := t.TempDir()
+
+	inputs, err := f.FetchDir(context.Background(), fetcher.FetchParams(`{"repo": "docs", "path": "docs", "entries": ["readme.md"]}`), dir)
+	if err != nil || len(inputs) != 1 || inputs[0] != filepath.FromSlash("docs/readme.md") {
+		t.Fatalf("unexpected inputs: %v, error: %v", inputs, err)
+	}
+
+	// the subtree is extracted, so the images could be referenced
+	if _, err = os.Stat(filepath.Join(dir, "docs", "images", "logo.png")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitFetchInvalid(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit(map[string]string{"docs/readme.md": "v1", "secret.md": "secret"})
+
+	f := repo.fetcher("1m")
+
+	tests := []string{
+		`{"repo": "docs", "path": "../secret.md"}`,
+		`{"repo": "docs", "path": "docs/../../secret.md"}`,
+		`{"repo": "docs", "path": "docs", "entries": ["../secret.md"]}`,
+		`{"repo": "docs", "ref": "--upload-pack=touch", "path": "docs/readme.md"}`,
+		`{"repo": "docs", "ref": "main:secret.md", "path": "docs/readme.md"}`,
+		`{"repo": "docs", "ref": "none", "path": "docs/readme.md"}`,
+		`{"repo": "other", "path": "docs/readme.md"}`,
+		`{"repo": "docs", "path": "docs/none.md"}`,
+		`{"repo": "docs", "path": "docs"}`,
+	}
+
+	for _, params := range tests {
+		if data, err := f.Fetch(fetcher.FetchParams(params)); err == nil {
+			t.Fatalf("params %s should be failed, data: %q", params, data)
+		}
+	}
+}
+
+func TestGitFetchRefresh(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit(map[string]string{"readme.md": "v1"})
+
+	f := repo.fetcher("1h")
+
+	params := fetcher.FetchParams(`{"repo": "docs", "ref": "main", "path": "readme.md"}`)
+
+	data, err := f.Fetch(params)
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("data: %q, error: %v", data, err)
+	}
+
+	v2 := repo.commit(map[string]string{"readme.md": "v2"})
+
+	// main is found in the mirror, it is not fetched in the fetch interval
+	data, err = f.Fetch(params)
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("main should be cached, data: %q, error: %v", data, err)
+	}
+
+	// the unknown commit is fetched at once
+	data, err = f.Fetch(fetcher.FetchParams(`{"repo": "docs", "ref": "` + v2 + `", "path": "readme.md"}`))
+	if err != nil || string(data) != "v2" {
+		t.Fatalf("the new commit should be fetched, data: %q, error: %v", data, err)
+	}
+
+	repo.commit(map[string]string{"readme.md": "v3"})
+
+	f.repos["docs"].fetchInterval = 0
+
+	data, err = f.Fetch(params)
+	if err != nil || string(data) != "v3" {
+		t.Fatalf("main should be fetched after the interval, data: %q, error: %v", data, err)
+	}
+}
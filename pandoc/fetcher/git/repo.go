@@ -0,0 +1,181 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// repository is the bare mirror of a remote in the cache dir
+type repository struct {
+	url string
+	dir string
+
+	fetchInterval time.Duration
+	lastFetch     time.Time
+
+	locker sync.Mutex
+}
+
+func newRepository(cacheDir, url string, fetchInterval time.Duration) *repository {
+	h := sha256.Sum256([]byte(url))
+
+	return &repository{
+		url:           url,
+		dir:           filepath.Join(cacheDir, hex.EncodeToString(h[:8])+".git"),
+		fetchInterval: fetchInterval,
+	}
+}
+
+// resolve returns the commit of ref, the mirror is cloned or fetched if
+// the ref is not found or the last fetch is older than fetch interval,
+// the commits are immutable so they are never fetched again once found
+func (p *repository) resolve(ctx context.Context, ref string) (commit string, err error) {
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	_, err = os.Stat(p.dir)
+
+	if os.IsNotExist(err) {
+		err = p.clone(ctx)
+		if err != nil {
+			return
+		}
+	} else if err != nil {
+		return
+	}
+
+	commit, err = p.revParse(ctx, ref)
+
+	if err == nil && (commit == ref || time.Now().Sub(p.lastFetch) < p.fetchInterval) {
+		return
+	}
+
+	err = p.fetch(ctx)
+	if err != nil {
+		return
+	}
+
+	commit, err = p.revParse(ctx, ref)
+	if err != nil {
+		err = fmt.Errorf("[fetcher-git]: ref %s not found", ref)
+		return
+	}
+
+	return
+}
+
+func (p *repository) clone(ctx context.Context) (err error) {
+
+	err = os.MkdirAll(filepath.Dir(p.dir), 0755)
+	if err != nil {
+		return
+	}
+
+	tmpDir := p.dir + ".tmp"
+
+	os.RemoveAll(tmpDir)
+
+	_, err = runGit(ctx, "", "clone", "--mirror", "--quiet", "--", p.url, tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return
+	}
+
+	err = os.Rename(tmpDir, p.dir)
+	if err != nil {
+		return
+	}
+
+	p.lastFetch = time.Now()
+
+	return
+}
+
+func (p *repository) fetch(ctx context.Context) (err error) {
+
+	_, err = runGit(ctx, p.dir, "fetch", "--prune", "--quiet", "origin")
+	if err != nil {
+		return
+	}
+
+	p.lastFetch = time.Now()
+
+	return
+}
+
+func (p *repository) revParse(ctx context.Context, ref string) (commit string, err error) {
+
+	out, err := runGit(ctx, p.dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return
+	}
+
+	commit = strings.TrimSpace(string(out))
+
+	return
+}
+
+// archive writes the tar of the path at commit to w
+func (p *repository) archive(ctx context.Context, commit, path string, w io.Writer) (err error) {
+
+	args := []string{"archive", "--format=tar", commit}
+
+	if len(path) > 0 {
+		args = append(args, "--", path)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = p.dir
+	cmd.Env = gitEnv()
+	cmd.Stdout = w
+
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("[fetcher-git]: git archive failure, error: %s, %s", err, strings.TrimSpace(stderr.String()))
+		return
+	}
+
+	return
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (out []byte, err error) {
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv()
+
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+
+	out, err = cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("[fetcher-git]: git %s failure, error: %s, %s", args[0], err, strings.TrimSpace(stderr.String()))
+		return
+	}
+
+	return
+}
+
+// gitEnv disables the prompts of credentials, and the system and global
+// configs of the running user
+func gitEnv() []string {
+	return append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+	)
+}
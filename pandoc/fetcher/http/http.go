@@ -2,17 +2,25 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/gogap/config"
 	"github.com/gogap/go-pandoc/pandoc/fetcher"
 )
 
 type HttpFetcher struct {
-	client *http.Client
+	client  *http.Client
+	maxSize int64
+	headers map[string]string // default headers, overridden by the params
+	retry   retryPolicy
 }
 
 type Params struct {
@@ -52,14 +60,40 @@ func init() {
 }
 
 func NewHttpFetcher(conf config.Configuration) (httpFetcher fetcher.Fetcher, err error) {
-	httpClient := &http.Client{}
-	httpFetcher = &HttpFetcher{
-		client: httpClient,
+	client, policy, err := newClient(conf)
+	if err != nil {
+		return
+	}
+
+	f := &HttpFetcher{
+		client:  client,
+		maxSize: 100 << 20,
+		retry:   newRetryPolicy(nil),
+	}
+
+	if conf != nil {
+		f.maxSize = conf.GetInt64("max-size", f.maxSize)
+		f.headers = newHeaders(conf.GetConfig("headers"))
+		f.retry = newRetryPolicy(conf.GetConfig("retry"))
 	}
+
+	// the default headers are usually credentials, they should not be sent
+	// to the urls provided by clients
+	if len(f.headers) > 0 && len(policy.AllowHosts) == 0 {
+		err = fmt.Errorf("[fetcher-http]: the default headers require network.allow-hosts")
+		return
+	}
+
+	httpFetcher = f
+
 	return
 }
 
 func (p *HttpFetcher) Fetch(fetchParams fetcher.FetchParams) (data []byte, err error) {
+	return p.FetchContext(context.Background(), fetchParams)
+}
+
+func (p *HttpFetcher) FetchContext(ctx context.Context, fetchParams fetcher.FetchParams) (data []byte, err error) {
 
 	params := Params{}
 
@@ -73,49 +107,161 @@ func (p *HttpFetcher) Fetch(fetchParams fetcher.FetchParams) (data []byte, err e
 		return
 	}
 
-	data, err = p.send(params)
+	data, err = p.send(ctx, params)
 
 	return
 }
 
-func (p *HttpFetcher) send(params Params) (data []byte, err error) {
+// do sends the request, and retries on the network errors, 429 and 5xx
+// by the retry policy, POST is only retried if retry-post is true
+func (p *HttpFetcher) do(ctx context.Context, params Params) (resp *http.Response, err error) {
 
-	body := bytes.NewBuffer(params.Data)
+	for i := 0; ; i++ {
+		var req *http.Request
+		req, err = http.NewRequest(params.Method, params.URL, bytes.NewReader(params.Data))
 
-	req, err := http.NewRequest(params.Method, params.URL, body)
+		if err != nil {
+			return
+		}
 
-	if err != nil {
-		return
-	}
+		req = req.WithContext(ctx)
+
+		for k, v := range p.headers {
+			req.Header.Set(k, v)
+		}
 
-	if len(params.Headers) > 0 {
 		for k, v := range params.Headers {
 			req.Header.Set(k, v)
 		}
+
+		resp, err = p.client.Do(req)
+
+		if i >= p.retry.maxRetries || !p.retry.retryable(params.Method) || !shouldRetry(resp, err) {
+			return
+		}
+
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(p.retry.wait(i)):
+		}
 	}
+}
+
+// FetchStream returns the response body as a stream, but the body is
+// read entirely if the params of replace is not empty
+func (p *HttpFetcher) FetchStream(ctx context.Context, fetchParams fetcher.FetchParams) (rc io.ReadCloser, meta fetcher.Metadata, err error) {
+
+	params := Params{}
 
-	resp, err := p.client.Do(req)
+	err = fetchParams.Unmarshal(&params)
+	if err != nil {
+		return
+	}
 
+	err = params.Validation()
 	if err != nil {
 		return
 	}
 
-	defer resp.Body.Close()
+	if len(params.Replace) == 0 {
+		return p.open(ctx, params)
+	}
+
+	rc, meta, err = p.open(ctx, params)
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
+
+	data, err := p.replace(rc, params)
+	if err != nil {
+		return
+	}
+
+	rc = ioutil.NopCloser(bytes.NewReader(data))
+	meta.Size = int64(len(data))
+
+	return
+}
+
+// open sends the request and returns the response body limited by max size
+func (p *HttpFetcher) open(ctx context.Context, params Params) (rc io.ReadCloser, meta fetcher.Metadata, err error) {
+
+	resp, err := p.do(ctx, params)
+
+	if err != nil {
+		return
+	}
 
 	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
 		err = fmt.Errorf("[fetcher-http]: fetch url by %s failure <%s>, status code is %d", params.Method, params.URL, resp.StatusCode)
 		return
 	}
 
-	data, err = ioutil.ReadAll(resp.Body)
+	if p.maxSize > 0 && resp.ContentLength > p.maxSize {
+		resp.Body.Close()
+		err = &fetcher.PayloadTooLargeError{Payload: "[fetcher-http]: response body", Limit: p.maxSize}
+		return
+	}
+
+	rc = struct {
+		io.Reader
+		io.Closer
+	}{fetcher.LimitReader(resp.Body, p.maxSize, "[fetcher-http]: response body"), resp.Body}
+
+	meta = fetcher.Metadata{
+		ContentType: resp.Header.Get("Content-Type"),
+		Filename:    responseFilename(resp),
+		Size:        resp.ContentLength,
+	}
+
+	return
+}
+
+func (p *HttpFetcher) replace(r io.Reader, params Params) (data []byte, err error) {
+
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
 
 	for k, v := range params.Replace {
 		data = bytes.Replace(data, []byte(k), []byte(v), -1)
 	}
 
+	return
+}
+
+func (p *HttpFetcher) send(ctx context.Context, params Params) (data []byte, err error) {
+
+	rc, _, err := p.open(ctx, params)
 	if err != nil {
 		return
 	}
 
-	return
+	defer rc.Close()
+
+	return p.replace(rc, params)
+}
+
+// responseFilename returns the filename of Content-Disposition, or the last
+// element of the url path
+func responseFilename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && len(params["filename"]) > 0 {
+		return path.Base(params["filename"])
+	}
+
+	if name := path.Base(resp.Request.URL.Path); name != "/" && name != "." {
+		return name
+	}
+
+	return ""
 }
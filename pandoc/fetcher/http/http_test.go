@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/netguard"
+)
+
+func TestNewHttpFetcherHeaders(t *testing.T) {
+	tests := []struct {
+		conf  string
+		valid bool
+	}{
+		{`max-size = 1024`, true},
+		{`headers { Authorization = "Bearer token" }`, false},
+		{`headers { Authorization = "Bearer token" }
+		  network { allow-hosts = ["wiki.example.com"] }`, true},
+	}
+
+	for _, test := range tests {
+		_, err := NewHttpFetcher(config.NewConfig(config.ConfigString(test.conf)))
+		if (err == nil) != test.valid {
+			t.Fatalf("config %q, valid: %v, error: %v", test.conf, test.valid, err)
+		}
+	}
+}
+
+func TestBlockedNotRetried(t *testing.T) {
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	f := &HttpFetcher{
+		client: netguard.DefaultPolicy().NewClient(),
+		retry:  retryPolicy{maxRetries: 3, backoff: time.Hour, maxBackoff: time.Hour},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err := f.send(ctx, Params{URL: srv.URL, Method: "GET"})
+
+	if !netguard.IsBlocked(err) || requests != 0 {
+		t.Fatalf("the loopback url should be blocked without retry, error: %v", err)
+	}
+}
+
+func TestRetryMethod(t *testing.T) {
+	tests := []struct {
+		method    string
+		retryPost bool
+		requests  int
+	}{
+		{"GET", false, 3},
+		{"POST", false, 1},
+		{"POST", true, 3},
+	}
+
+	for _, test := range tests {
+		requests := 0
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+
+		policy := netguard.DefaultPolicy()
+		policy.AllowPrivate = true
+
+		f := &HttpFetcher{
+			client: policy.NewClient(),
+			retry:  retryPolicy{maxRetries: 2, backoff: time.Millisecond, maxBackoff: time.Millisecond, retryPost: test.retryPost},
+		}
+
+		_, err := f.send(context.Background(), Params{URL: srv.URL, Method: test.method})
+
+		srv.Close()
+
+		if err == nil || requests != test.requests {
+			t.Fatalf("%s, retry-post: %v, requests: %d, error: %v", test.method, test.retryPost, requests, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/netguard"
+)
+
+type retryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	retryPost  bool
+}
+
+// retryable reports whether the requests of method could be retried, POST
+// is not idempotent, it may be acted on by the server before the failure
+func (p *retryPolicy) retryable(method string) bool {
+	return method == "GET" || (method == "POST" && p.retryPost)
+}
+
+func (p *retryPolicy) wait(retries int) time.Duration {
+	backoff := p.backoff << uint(retries)
+	if backoff <= 0 || backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+
+	return backoff
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	// the blocked url is always blocked
+	if err != nil {
+		return !netguard.IsBlocked(err)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func newClient(conf config.Configuration) (client *http.Client, policy *netguard.Policy, err error) {
+
+	var networkConf config.Configuration
+	if conf != nil {
+		networkConf = conf.GetConfig("network")
+	}
+
+	policy, err = netguard.NewPolicy(networkConf)
+	if err != nil {
+		return
+	}
+
+	if conf == nil {
+		client = policy.NewClient()
+		return
+	}
+
+	policy.Timeout = conf.GetTimeDuration("timeout", policy.Timeout)
+	policy.MaxRedirects = int(conf.GetInt32("max-redirects", int32(policy.MaxRedirects)))
+
+	var transport *http.Transport
+
+	if proxy := conf.GetString("proxy"); len(proxy) > 0 {
+		var proxyURL *url.URL
+		proxyURL, err = url.Parse(proxy)
+		if err != nil {
+			err = fmt.Errorf("[fetcher-http]: parse proxy url failure, error: %s", err)
+			return
+		}
+
+		transport = policy.NewProxyTransport(proxyURL)
+	} else {
+		transport = policy.NewTransport()
+	}
+
+	transport.TLSClientConfig, err = newTLSConfig(conf.GetConfig("tls"))
+	if err != nil {
+		return
+	}
+
+	client = &http.Client{
+		Transport:     &netguard.Transport{Policy: policy, Base: transport},
+		CheckRedirect: policy.CheckRedirect,
+		Timeout:       policy.Timeout,
+	}
+
+	return
+}
+
+func newTLSConfig(conf config.Configuration) (tlsConfig *tls.Config, err error) {
+
+	if conf == nil {
+		return
+	}
+
+	tlsConfig = &tls.Config{
+		InsecureSkipVerify: conf.GetBoolean("insecure-skip-verify", false),
+	}
+
+	if ca := conf.GetString("ca"); len(ca) > 0 {
+		var pem []byte
+		pem, err = ioutil.ReadFile(ca)
+		if err != nil {
+			err = fmt.Errorf("[fetcher-http]: read ca file failure, error: %s", err)
+			return
+		}
+
+		tlsConfig.RootCAs, err = x509.SystemCertPool()
+		if err != nil || tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			err = nil
+		}
+
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("[fetcher-http]: no certificate found in ca file %s", ca)
+			return
+		}
+	}
+
+	cert, key := conf.GetString("cert"), conf.GetString("key")
+
+	if len(cert) > 0 || len(key) > 0 {
+		var certificate tls.Certificate
+		certificate, err = tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			err = fmt.Errorf("[fetcher-http]: load client certificate failure, error: %s", err)
+			return
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return
+}
+
+// newRetryPolicy creates the policy of retry config, only GET is retried
+// unless retry-post is true, the POST timed out may be replayed then
+func newRetryPolicy(conf config.Configuration) retryPolicy {
+	retry := retryPolicy{
+		backoff:    time.Second,
+		maxBackoff: time.Second * 10,
+	}
+
+	if conf == nil {
+		return retry
+	}
+
+	retry.maxRetries = int(conf.GetInt32("max-retries", 0))
+	retry.backoff = conf.GetTimeDuration("backoff", retry.backoff)
+	retry.maxBackoff = conf.GetTimeDuration("max-backoff", retry.maxBackoff)
+	retry.retryPost = conf.GetBoolean("retry-post", false)
+
+	return retry
+}
+
+func newHeaders(conf config.Configuration) map[string]string {
+	if conf == nil {
+		return nil
+	}
+
+	headers := make(map[string]string)
+
+	for _, k := range conf.Keys() {
+		headers[k] = conf.GetString(k)
+	}
+
+	return headers
+}
@@ -0,0 +1,68 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// PayloadTooLargeError is returned when the size of the payload, e.g. the
+// fetched input, the downloaded file or the output, exceeds the limit
+type PayloadTooLargeError struct {
+	Payload string
+	Limit   int64
+}
+
+func (p *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("%s is too large, the limit is %d bytes", p.Payload, p.Limit)
+}
+
+func IsPayloadTooLarge(err error) bool {
+	var e *PayloadTooLargeError
+	return errors.As(err, &e)
+}
+
+type limitedReader struct {
+	r       io.Reader
+	n       int64
+	limit   int64
+	payload string
+}
+
+// LimitReader returns a PayloadTooLargeError if more than limit bytes are
+// read from r, the limit <= 0 means no limit
+func LimitReader(r io.Reader, limit int64, payload string) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+
+	return &limitedReader{r: r, limit: limit, payload: payload}
+}
+
+func (p *limitedReader) Read(b []byte) (n int, err error) {
+	if p.n > p.limit {
+		err = &PayloadTooLargeError{Payload: p.payload, Limit: p.limit}
+		return
+	}
+
+	// read one more byte to know whether the limit is exceeded
+	if remain := p.limit - p.n + 1; int64(len(b)) > remain {
+		b = b[:remain]
+	}
+
+	n, err = p.r.Read(b)
+	p.n += int64(n)
+
+	if p.n > p.limit {
+		n -= int(p.n - p.limit)
+		err = &PayloadTooLargeError{Payload: p.payload, Limit: p.limit}
+	}
+
+	return
+}
+
+// ReadAll reads from r until EOF, the limit <= 0 means no limit
+func ReadAll(r io.Reader, limit int64, payload string) (data []byte, err error) {
+	return ioutil.ReadAll(LimitReader(r, limit, payload))
+}
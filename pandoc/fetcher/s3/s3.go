@@ -0,0 +1,247 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+type S3Fetcher struct {
+	client *http.Client
+
+	endpoint     *url.URL
+	region       string
+	credentials  Credentials
+	pathStyle    bool
+	bucket       string // the default bucket
+	allowBuckets map[string]bool
+	maxSize      int64
+}
+
+type Params struct {
+	Bucket  string `json:"bucket"`
+	Key     string `json:"key"`
+	Version string `json:"version"`
+}
+
+func (p *Params) Validation() (err error) {
+	if !bucketNameRegexp.MatchString(p.Bucket) {
+		err = fmt.Errorf("[fetcher-s3]: params of bucket %s is invalid", p.Bucket)
+		return
+	}
+
+	p.Key = strings.TrimPrefix(p.Key, "/")
+
+	if len(p.Key) == 0 {
+		err = fmt.Errorf("[fetcher-s3]: params of key is empty")
+		return
+	}
+
+	// the .. segments are resolved to the other buckets in path style
+	for _, segment := range strings.Split(p.Key, "/") {
+		if segment == ".." {
+			err = fmt.Errorf("[fetcher-s3]: params of key %s is invalid", p.Key)
+			return
+		}
+	}
+
+	return
+}
+
+func init() {
+	err := fetcher.RegisterFetcher("s3", NewS3Fetcher)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewS3Fetcher(conf config.Configuration) (s3Fetcher fetcher.Fetcher, err error) {
+
+	if conf == nil {
+		err = fmt.Errorf("[fetcher-s3]: options is empty")
+		return
+	}
+
+	region := conf.GetString("region", "us-east-1")
+
+	endpoint := conf.GetString("endpoint", "https://s3."+region+".amazonaws.com")
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		err = fmt.Errorf("[fetcher-s3]: parse endpoint failure, error: %s", err)
+		return
+	}
+
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		err = fmt.Errorf("[fetcher-s3]: endpoint schema %s not support", endpointURL.Scheme)
+		return
+	}
+
+	f := &S3Fetcher{
+		// the endpoint is configured by the operator, so the network policy
+		// is not used, the buckets could be restricted by allow-buckets
+		client: &http.Client{Timeout: conf.GetTimeDuration("timeout", time.Second*30)},
+
+		endpoint: endpointURL,
+		region:   region,
+		credentials: Credentials{
+			AccessKeyID:     conf.GetString("access-key-id"),
+			SecretAccessKey: conf.GetString("secret-access-key"),
+			SessionToken:    conf.GetString("session-token"),
+		},
+		pathStyle:    conf.GetBoolean("path-style", false),
+		bucket:       conf.GetString("bucket"),
+		allowBuckets: make(map[string]bool),
+		maxSize:      conf.GetInt64("max-size", 100<<20),
+	}
+
+	for _, bucket := range conf.GetStringList("allow-buckets") {
+		f.allowBuckets[bucket] = true
+	}
+
+	if len(f.bucket) > 0 {
+		f.allowBuckets[f.bucket] = true
+	}
+
+	// the credentials could read the other buckets, so they are denied
+	// unless allowed explicitly, * allows all buckets
+	if len(f.allowBuckets) == 0 {
+		err = fmt.Errorf("[fetcher-s3]: allow-buckets or bucket is required")
+		return
+	}
+
+	s3Fetcher = f
+
+	return
+}
+
+func (p *S3Fetcher) Fetch(fetchParams fetcher.FetchParams) (data []byte, err error) {
+	return p.FetchContext(context.Background(), fetchParams)
+}
+
+func (p *S3Fetcher) FetchContext(ctx context.Context, fetchParams fetcher.FetchParams) (data []byte, err error) {
+
+	rc, _, err := p.FetchStream(ctx, fetchParams)
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+func (p *S3Fetcher) FetchStream(ctx context.Context, fetchParams fetcher.FetchParams) (rc io.ReadCloser, meta fetcher.Metadata, err error) {
+
+	params := Params{Bucket: p.bucket}
+
+	err = fetchParams.Unmarshal(&params)
+	if err != nil {
+		return
+	}
+
+	err = params.Validation()
+	if err != nil {
+		return
+	}
+
+	if !p.allowBuckets["*"] && !p.allowBuckets[params.Bucket] {
+		err = fmt.Errorf("[fetcher-s3]: bucket %s is not allowed", params.Bucket)
+		return
+	}
+
+	return p.getObject(ctx, params)
+}
+
+func (p *S3Fetcher) objectURL(params Params) *url.URL {
+	u := *p.endpoint
+
+	objectPath := strings.TrimRight(u.Path, "/") + "/" + params.Key
+
+	if p.pathStyle {
+		objectPath = strings.TrimRight(u.Path, "/") + "/" + params.Bucket + "/" + params.Key
+	} else {
+		u.Host = params.Bucket + "." + u.Host
+	}
+
+	u.Path = objectPath
+	u.RawPath = uriEncode(objectPath, false)
+	u.RawQuery = ""
+
+	if len(params.Version) > 0 {
+		u.RawQuery = "versionId=" + uriEncode(params.Version, true)
+	}
+
+	return &u
+}
+
+// getObject returns the body of object limited by max size
+func (p *S3Fetcher) getObject(ctx context.Context, params Params) (rc io.ReadCloser, meta fetcher.Metadata, err error) {
+
+	req, err := http.NewRequest("GET", p.objectURL(params).String(), nil)
+	if err != nil {
+		return
+	}
+
+	// anonymous access for the public buckets
+	if len(p.credentials.AccessKeyID) > 0 {
+		signV4(req, p.credentials, p.region, time.Now())
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		err = fmt.Errorf("[fetcher-s3]: get object %s/%s failure, status code is %d, %s",
+			params.Bucket, params.Key, resp.StatusCode, errorCode(body))
+		return
+	}
+
+	if p.maxSize > 0 && resp.ContentLength > p.maxSize {
+		resp.Body.Close()
+		err = &fetcher.PayloadTooLargeError{Payload: "[fetcher-s3]: object", Limit: p.maxSize}
+		return
+	}
+
+	rc = struct {
+		io.Reader
+		io.Closer
+	}{fetcher.LimitReader(resp.Body, p.maxSize, "[fetcher-s3]: object"), resp.Body}
+
+	meta = fetcher.Metadata{
+		ContentType: resp.Header.Get("Content-Type"),
+		Filename:    path.Base(params.Key),
+		Size:        resp.ContentLength,
+	}
+
+	return
+}
+
+var errorCodeRegexp = regexp.MustCompile(`<Code>([^<]*)</Code>`)
+
+// errorCode extracts the code from the s3 error response, e.g. NoSuchKey
+func errorCode(body []byte) string {
+	matches := errorCodeRegexp.FindSubmatch(body)
+	if len(matches) < 2 {
+		return "unknown error"
+	}
+
+	return string(matches[1])
+}
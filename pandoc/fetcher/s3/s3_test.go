@@ -0,0 +1,118 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+func newTestFetcher(t *testing.T, endpoint, options string) *S3Fetcher {
+	conf := config.NewConfig(config.ConfigString(fmt.Sprintf(`
+		endpoint          = "%s"
+		access-key-id     = "ak"
+		secret-access-key = "sk"
+		path-style        = true
+		%s
+	`, endpoint, options)))
+
+	f, err := NewS3Fetcher(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f.(*S3Fetcher)
+}
+
+func TestS3Fetch(t *testing.T) {
+	objects := map[string]string{
+		"/docs/guides/readme.md": "# readme",
+		"/docs/large.md":         strings.Repeat("a", 100),
+		"/docs/stream.md":        strings.Repeat("a", 100),
+		"/secrets/readme.md":     "secret",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/") {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		data, exist := objects[req.URL.Path]
+		if !exist {
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+			return
+		}
+
+		// the chunked response has no content length
+		if strings.HasPrefix(req.URL.Path, "/docs/stream") {
+			rw.(http.Flusher).Flush()
+		}
+
+		rw.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(t, srv.URL, `
+		bucket   = "docs"
+		max-size = 64
+	`)
+
+	tests := []struct {
+		params   string
+		data     string
+		tooLarge bool
+	}{
+		{`{"key": "guides/readme.md"}`, "# readme", false},
+		{`{"bucket": "docs", "key": "/guides/readme.md"}`, "# readme", false},
+		{`{"key": "guides/none.md"}`, "", false},
+		{`{"bucket": "secrets", "key": "readme.md"}`, "", false},
+		{`{"key": "../secrets/readme.md"}`, "", false},
+		{`{"key": "guides/../../secrets/readme.md"}`, "", false},
+		{`{"key": "large.md"}`, "", true},
+		{`{"key": "stream.md"}`, "", true},
+	}
+
+	for _, test := range tests {
+		data, err := f.FetchContext(context.Background(), fetcher.FetchParams(test.params))
+
+		if len(test.data) > 0 {
+			if err != nil || string(data) != test.data {
+				t.Fatalf("params %s, data: %q, error: %v", test.params, data, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("params %s should be failed, data: %q", test.params, data)
+		}
+
+		if fetcher.IsPayloadTooLarge(err) != test.tooLarge {
+			t.Fatalf("params %s, too large: %v, error: %v", test.params, test.tooLarge, err)
+		}
+	}
+}
+
+func TestS3AllowBuckets(t *testing.T) {
+	_, err := NewS3Fetcher(config.NewConfig(config.ConfigString(`endpoint = "http://minio:9000"`)))
+	if err == nil {
+		t.Fatal("the fetcher without buckets should be rejected")
+	}
+
+	f := newTestFetcher(t, "http://minio:9000", `allow-buckets = ["docs", "images"]`)
+
+	if !f.allowBuckets["docs"] || !f.allowBuckets["images"] || f.allowBuckets["secrets"] {
+		t.Fatalf("unexpected buckets %v", f.allowBuckets)
+	}
+
+	_, err = f.FetchContext(context.Background(), fetcher.FetchParams(`{"bucket": "secrets", "key": "readme.md"}`))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("the bucket should be denied, error: %v", err)
+	}
+}
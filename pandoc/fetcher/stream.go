@@ -0,0 +1,40 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// Metadata describes the fetched content, the empty fields are unknown
+type Metadata struct {
+	ContentType string
+	Filename    string
+	Size        int64 // -1 if unknown
+}
+
+// StreamFetcher is a Fetcher which returns the content as a stream, so the
+// large document is not held in memory, the caller should close the stream
+type StreamFetcher interface {
+	Fetcher
+	FetchStream(ctx context.Context, params FetchParams) (rc io.ReadCloser, meta Metadata, err error)
+}
+
+// Stream calls FetchStream if the fetcher is a StreamFetcher, otherwise
+// the data returned by Fetch is adapted as a stream
+func Stream(ctx context.Context, f Fetcher, params FetchParams) (rc io.ReadCloser, meta Metadata, err error) {
+	if sf, ok := f.(StreamFetcher); ok {
+		return sf.FetchStream(ctx, params)
+	}
+
+	data, err := Fetch(ctx, f, params)
+	if err != nil {
+		return
+	}
+
+	rc = ioutil.NopCloser(bytes.NewReader(data))
+	meta.Size = int64(len(data))
+
+	return
+}
@@ -1,6 +1,7 @@
 package pandoc
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -13,12 +14,17 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
 	"github.com/google/uuid"
 )
 
 type File struct {
 	Url     string
 	SafeDir string
+	WorkDir string // relative paths are resolved in it, e.g. the attachments of the conversion
+
+	Client  *http.Client // downloads the http urls, http.DefaultClient if nil
+	MaxSize int64        // max bytes of the downloaded file, no limit if <= 0
 
 	TempDirPrefix string
 
@@ -30,6 +36,10 @@ type File struct {
 }
 
 func (p *File) Path() (filename string, err error) {
+	return p.PathContext(context.Background())
+}
+
+func (p *File) PathContext(ctx context.Context) (filename string, err error) {
 	p.initOnce.Do(
 		func() {
 			if len(p.Url) == 0 {
@@ -40,13 +50,15 @@ func (p *File) Path() (filename string, err error) {
 			u, p.lastError = url.Parse(p.Url)
 			switch u.Scheme {
 			case "http", "https":
-				p.path, p.lastError = p.downloadToFile()
+				p.path, p.lastError = p.downloadToFile(ctx)
 				p.shouldCleanup = true
 			case "data":
 				p.path, p.lastError = p.base64dataToFile()
 				p.shouldCleanup = true
 			case "file", "":
-				if !strings.HasPrefix(u.Path, p.SafeDir) {
+				if len(p.WorkDir) > 0 && !filepath.IsAbs(u.Path) {
+					p.path, p.lastError = p.workDirFile(u.Path)
+				} else if !inSafeDir(p.SafeDir, u.Path) {
 					p.lastError = fmt.Errorf("file path is not in safe dir")
 				} else {
 					p.path = u.Path
@@ -60,11 +72,63 @@ func (p *File) Path() (filename string, err error) {
 	return p.path, p.lastError
 }
 
-func (p *File) downloadToFile() (fname string, err error) {
+// inSafeDir reports whether the path is in the safe dir after the symlinks
+// resolved, so neither '..' nor the symlinks could escape from it
+func inSafeDir(safeDir, path string) bool {
+	if len(safeDir) == 0 {
+		return true
+	}
+
+	realDir, err := filepath.EvalSymlinks(safeDir)
+	if err != nil {
+		return false
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(realDir, realPath)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (p *File) workDirFile(name string) (fname string, err error) {
+	fname = filepath.Join(p.WorkDir, filepath.Clean(name))
+
+	rel, err := filepath.Rel(p.WorkDir, fname)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("file path is not in work dir")
+		return
+	}
+
+	_, err = os.Stat(fname)
+	if err != nil {
+		err = fmt.Errorf("file %s not exist in work dir", name)
+		return
+	}
+
+	return
+}
+
+func (p *File) downloadToFile(ctx context.Context) (fname string, err error) {
 
-	cli := http.DefaultClient
+	cli := p.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+
+	req, err := http.NewRequest("GET", p.Url, nil)
+	if err != nil {
+		err = fmt.Errorf("download file failure for url %s, error: %s", p.Url, err)
+		return
+	}
 
-	resp, err := cli.Get(p.Url)
+	resp, err := cli.Do(req.WithContext(ctx))
 
 	if err != nil {
 		err = fmt.Errorf("download file failure for url %s, error: %s", p.Url, err)
@@ -73,6 +137,11 @@ func (p *File) downloadToFile() (fname string, err error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("download file failure for url %s, status code is %d", p.Url, resp.StatusCode)
+		return
+	}
+
 	ct := resp.Header.Get("Content-Type")
 
 	filename, err := p.urlToFileName(p.Url, ct)
@@ -81,9 +150,16 @@ func (p *File) downloadToFile() (fname string, err error) {
 		return
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	if p.MaxSize > 0 && resp.ContentLength > p.MaxSize {
+		err = &fetcher.PayloadTooLargeError{Payload: "file " + p.Url, Limit: p.MaxSize}
+		return
+	}
+
+	data, err := fetcher.ReadAll(resp.Body, p.MaxSize, "file "+p.Url)
 	if err != nil {
-		err = fmt.Errorf("read body from %s, error: %s", p.Url, err)
+		if !fetcher.IsPayloadTooLarge(err) {
+			err = fmt.Errorf("read body from %s, error: %s", p.Url, err)
+		}
 		return
 	}
 
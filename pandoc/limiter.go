@@ -0,0 +1,103 @@
+package pandoc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrQueueFull    = errors.New("too many conversions, the queue is full")
+	ErrQueueTimeout = errors.New("wait for conversion slot timeout")
+)
+
+type Stats struct {
+	Running int64 `json:"running"`
+	Queued  int64 `json:"queued"`
+}
+
+type limiter struct {
+	slots        chan struct{} // nil if unlimited
+	queueSize    int64
+	queueTimeout time.Duration
+
+	running int64
+	queued  int64
+}
+
+// newLimiter returns the limiter of pandoc processes, the concurrency is
+// unlimited if maxConcurrency <= 0
+func newLimiter(maxConcurrency, queueSize int, queueTimeout time.Duration) *limiter {
+	l := &limiter{
+		queueSize:    int64(queueSize),
+		queueTimeout: queueTimeout,
+	}
+
+	if maxConcurrency > 0 {
+		l.slots = make(chan struct{}, maxConcurrency)
+	}
+
+	return l
+}
+
+func (p *limiter) Acquire(ctx context.Context) (wait time.Duration, err error) {
+
+	begin := time.Now()
+
+	if p.slots == nil {
+		atomic.AddInt64(&p.running, 1)
+		return
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		atomic.AddInt64(&p.running, 1)
+		return
+	default:
+	}
+
+	if atomic.AddInt64(&p.queued, 1) > p.queueSize {
+		atomic.AddInt64(&p.queued, -1)
+		err = ErrQueueFull
+		return
+	}
+
+	defer atomic.AddInt64(&p.queued, -1)
+
+	var timeout <-chan time.Time
+
+	if p.queueTimeout > 0 {
+		timer := time.NewTimer(p.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		atomic.AddInt64(&p.running, 1)
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	wait = time.Now().Sub(begin)
+
+	return
+}
+
+func (p *limiter) Release() {
+	atomic.AddInt64(&p.running, -1)
+
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+func (p *limiter) Stats() Stats {
+	return Stats{
+		Running: atomic.LoadInt64(&p.running),
+		Queued:  atomic.LoadInt64(&p.queued),
+	}
+}
@@ -0,0 +1,49 @@
+package pandoc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		maxConcurrency int
+		queueSize      int
+		running        int // acquired before the last one
+		err            error
+	}{
+		{0, 0, 10, nil},
+		{-1, 0, 10, nil},
+		{2, 0, 1, nil},
+		{2, 0, 2, ErrQueueFull},
+		{1, 1, 1, ErrQueueTimeout},
+	}
+
+	for i, test := range tests {
+		l := newLimiter(test.maxConcurrency, test.queueSize, time.Millisecond*10)
+
+		for j := 0; j < test.running; j++ {
+			if _, err := l.Acquire(context.Background()); err != nil {
+				t.Fatalf("test %d, acquire %d failure, error: %v", i, j, err)
+			}
+		}
+
+		_, err := l.Acquire(context.Background())
+		if err != test.err {
+			t.Fatalf("test %d, error: %v, expected: %v", i, err, test.err)
+		}
+
+		if err == nil {
+			l.Release()
+		}
+
+		for j := 0; j < test.running; j++ {
+			l.Release()
+		}
+
+		if stats := l.Stats(); stats.Running != 0 || stats.Queued != 0 {
+			t.Fatalf("test %d, unexpected stats %+v", i, stats)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gogap/config"
+)
+
+// Policy restricts the outgoing http requests to the urls provided by
+// clients, to protect the internal services from SSRF
+type Policy struct {
+	Schemes      []string
+	AllowHosts   []string // exact host or wildcard like *.example.com
+	DenyHosts    []string
+	AllowCIDRs   []*net.IPNet // allowed even they are private
+	DenyCIDRs    []*net.IPNet
+	AllowPrivate bool // allow loopback, private, link-local and unspecified addresses
+	MaxRedirects int
+	Timeout      time.Duration
+}
+
+// BlockedError is returned if the url or the address is denied by the policy
+type BlockedError struct {
+	Reason string
+}
+
+func (p *BlockedError) Error() string {
+	return p.Reason
+}
+
+func blocked(format string, args ...interface{}) error {
+	return &BlockedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsBlocked reports whether the error is caused by the policy, e.g. the
+// errors of http client wrapping it, the request should not be retried
+func IsBlocked(err error) bool {
+	var blockedErr *BlockedError
+	return errors.As(err, &blockedErr)
+}
+
+// DefaultPolicy denies the private addresses
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Schemes:      []string{"http", "https"},
+		MaxRedirects: 5,
+		Timeout:      time.Second * 30,
+	}
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultPolicy = DefaultPolicy()
+)
+
+// SetDefault sets the policy shared by the fetchers and callbacks without
+// their own network config, e.g. the policy of pandoc.network
+func SetDefault(policy *Policy) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultPolicy = policy
+}
+
+// Default returns a copy of the policy set by SetDefault, or DefaultPolicy
+func Default() *Policy {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	policy := *defaultPolicy
+	return &policy
+}
+
+// NewPolicy creates policy from config, the fields not set in config are
+// the same as the Default, the nil config returns the Default
+func NewPolicy(conf config.Configuration) (policy *Policy, err error) {
+	return Default().Override(conf)
+}
+
+// Override returns a copy of the policy with the fields set in config
+func (p *Policy) Override(conf config.Configuration) (policy *Policy, err error) {
+
+	copied := *p
+	policy = &copied
+
+	if conf == nil {
+		return
+	}
+
+	if schemes := conf.GetStringList("schemes"); len(schemes) > 0 {
+		policy.Schemes = schemes
+	}
+
+	if conf.HasPath("allow-hosts") {
+		policy.AllowHosts = conf.GetStringList("allow-hosts")
+	}
+
+	if conf.HasPath("deny-hosts") {
+		policy.DenyHosts = conf.GetStringList("deny-hosts")
+	}
+
+	policy.AllowPrivate = conf.GetBoolean("allow-private", policy.AllowPrivate)
+	policy.MaxRedirects = int(conf.GetInt32("max-redirects", int32(policy.MaxRedirects)))
+	policy.Timeout = conf.GetTimeDuration("timeout", policy.Timeout)
+
+	if conf.HasPath("allow-cidrs") {
+		policy.AllowCIDRs, err = parseCIDRs(conf.GetStringList("allow-cidrs"))
+		if err != nil {
+			return
+		}
+	}
+
+	if conf.HasPath("deny-cidrs") {
+		policy.DenyCIDRs, err = parseCIDRs(conf.GetStringList("deny-cidrs"))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func parseCIDRs(list []string) (nets []*net.IPNet, err error) {
+	for _, s := range list {
+		_, ipNet, e := net.ParseCIDR(s)
+		if e != nil {
+			err = fmt.Errorf("parse cidr %s failure, error: %s", s, e)
+			return
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return
+}
+
+func (p *Policy) CheckURL(u *url.URL) (err error) {
+
+	if !containsFold(p.Schemes, u.Scheme) {
+		err = blocked("url scheme %s is not allowed", u.Scheme)
+		return
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	if len(host) == 0 {
+		err = blocked("url host is empty")
+		return
+	}
+
+	if matchHosts(p.DenyHosts, host) {
+		err = blocked("url host %s is denied", host)
+		return
+	}
+
+	if len(p.AllowHosts) > 0 && !matchHosts(p.AllowHosts, host) {
+		err = blocked("url host %s is not allowed", host)
+		return
+	}
+
+	// check the literal ip before dialing, the resolved ip is checked by dialer
+	if ip := net.ParseIP(host); ip != nil {
+		err = p.CheckIP(ip)
+	}
+
+	return
+}
+
+func (p *Policy) CheckIP(ip net.IP) (err error) {
+
+	if containsIP(p.DenyCIDRs, ip) {
+		err = blocked("ip %s is denied", ip)
+		return
+	}
+
+	if containsIP(p.AllowCIDRs, ip) || p.AllowPrivate {
+		return
+	}
+
+	if isPrivate(ip) {
+		err = blocked("ip %s is private", ip)
+		return
+	}
+
+	return
+}
+
+// DialContext checks the resolved address before connecting, so the
+// dns rebinding and the redirects to internal addresses are blocked
+func (p *Policy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   time.Second * 30,
+		KeepAlive: time.Second * 30,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return blocked("invalid ip %s", host)
+			}
+
+			return p.CheckIP(ip)
+		},
+	}
+
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (p *Policy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > p.MaxRedirects {
+		return blocked("stopped after %d redirects", p.MaxRedirects)
+	}
+
+	return p.CheckURL(req.URL)
+}
+
+// NewTransport returns the transport which dials by the policy,
+// the proxy from environment is not used, it hides the target address
+func (p *Policy) NewTransport() *http.Transport {
+	return &http.Transport{
+		DialContext:           p.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       time.Second * 90,
+		TLSHandshakeTimeout:   time.Second * 10,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// NewProxyTransport returns the transport which sends requests by the proxy,
+// the proxy is trusted, only the urls are checked, the resolved addresses of
+// the target hosts are unknown and should be restricted by the proxy itself
+func (p *Policy) NewProxyTransport(proxy *url.URL) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   time.Second * 30,
+		KeepAlive: time.Second * 30,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyURL(proxy),
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       time.Second * 90,
+		TLSHandshakeTimeout:   time.Second * 10,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+func (p *Policy) NewClient() *http.Client {
+	return &http.Client{
+		Transport:     &Transport{Policy: p, Base: p.NewTransport()},
+		CheckRedirect: p.CheckRedirect,
+		Timeout:       p.Timeout,
+	}
+}
+
+// Transport checks the url of each request by the policy before
+// sending it by the Base transport
+type Transport struct {
+	Policy *Policy
+	Base   http.RoundTripper
+}
+
+func (p *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := p.Policy.CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	return p.Base.RoundTrip(req)
+}
+
+// blockedCIDRs are the special purpose ranges not covered by the predicates
+// of net.IP, they are not routable on the internet but could reach the
+// internal services, e.g. the metadata endpoint of cloud in CGNAT range
+var blockedCIDRs = mustParseCIDRs(
+	"0.0.0.0/8",       // this network
+	"100.64.0.0/10",   // carrier-grade NAT, e.g. 100.100.100.200
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved, including the broadcast
+	"64:ff9b:1::/48",  // local-use NAT64
+	"100::/64",        // discard-only
+	"2001:db8::/32",   // documentation
+)
+
+// the NAT64 and 6to4 prefixes, the ipv4 addresses are embedded in them
+var (
+	nat64Prefix = mustParseCIDRs("64:ff9b::/96")[0]
+	sixToFour   = mustParseCIDRs("2002::/16")[0]
+)
+
+func mustParseCIDRs(list ...string) []*net.IPNet {
+	nets, err := parseCIDRs(list)
+	if err != nil {
+		panic(err)
+	}
+
+	return nets
+}
+
+// embeddedIPv4 returns the ipv4 address in the ipv4-mapped, NAT64 or 6to4
+// address, so the private ipv4 could not be reached by them
+func embeddedIPv4(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+
+	switch {
+	case nat64Prefix.Contains(ip):
+		return net.IP(ip[12:16])
+	case sixToFour.Contains(ip):
+		return net.IP(ip[2:6])
+	}
+
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	if v4 := embeddedIPv4(ip); v4 != nil {
+		ip = v4
+	}
+
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		containsIP(blockedCIDRs, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchHosts(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+
+		if pattern == host {
+			return true
+		}
+
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package netguard
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gogap/config"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return ipNet
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		policy  *Policy
+		url     string
+		allowed bool
+	}{
+		{DefaultPolicy(), "https://example.com/doc.md", true},
+		{DefaultPolicy(), "http://8.8.8.8/doc.md", true},
+		{DefaultPolicy(), "ftp://example.com/doc.md", false},
+		{DefaultPolicy(), "file:///etc/passwd", false},
+		{DefaultPolicy(), "http://127.0.0.1/", false},
+		{DefaultPolicy(), "http://[::1]/", false},
+		{DefaultPolicy(), "http://10.1.2.3/", false},
+		{DefaultPolicy(), "http://192.168.1.1/", false},
+		{DefaultPolicy(), "http://169.254.169.254/latest/meta-data", false},
+		{DefaultPolicy(), "http://0.0.0.0/", false},
+		{DefaultPolicy(), "http://0.1.2.3/", false},
+		{DefaultPolicy(), "http://100.64.0.1/", false},
+		{DefaultPolicy(), "http://100.100.100.200/latest/meta-data", false},
+		{DefaultPolicy(), "http://100.128.0.1/", true},
+		{DefaultPolicy(), "http://198.18.0.1/", false},
+		{DefaultPolicy(), "http://198.19.255.255/", false},
+		{DefaultPolicy(), "http://198.20.0.1/", true},
+		{DefaultPolicy(), "http://192.0.0.8/", false},
+		{DefaultPolicy(), "http://240.0.0.1/", false},
+		{DefaultPolicy(), "http://255.255.255.255/", false},
+		{DefaultPolicy(), "http://[::ffff:127.0.0.1]/", false},
+		{DefaultPolicy(), "http://[::ffff:100.100.100.200]/", false},
+		{DefaultPolicy(), "http://[64:ff9b::a00:1]/", false},
+		{DefaultPolicy(), "http://[64:ff9b::a9fe:a9fe]/", false},
+		{DefaultPolicy(), "http://[64:ff9b::6464:64c8]/", false},
+		{DefaultPolicy(), "http://[64:ff9b::808:808]/", true},
+		{DefaultPolicy(), "http://[64:ff9b:1::1]/", false},
+		{DefaultPolicy(), "http://[2002:7f00:1::]/", false},
+		{DefaultPolicy(), "http://[2002:808:808::]/", true},
+		{DefaultPolicy(), "http://[fd00::1]/", false},
+		{DefaultPolicy(), "http://[2606:4700::1111]/", true},
+		{&Policy{Schemes: []string{"http"}, AllowPrivate: true}, "http://10.1.2.3/", true},
+		{&Policy{Schemes: []string{"http"}, AllowCIDRs: []*net.IPNet{mustCIDR("10.0.0.0/8")}}, "http://10.1.2.3/", true},
+		{&Policy{Schemes: []string{"http"}, AllowCIDRs: []*net.IPNet{mustCIDR("10.0.0.0/8")}}, "http://192.168.1.1/", false},
+		{&Policy{Schemes: []string{"http"}, AllowPrivate: true, DenyCIDRs: []*net.IPNet{mustCIDR("10.0.0.0/8")}}, "http://10.1.2.3/", false},
+		{&Policy{Schemes: []string{"https"}, AllowHosts: []string{"*.example.com"}}, "https://wiki.example.com/", true},
+		{&Policy{Schemes: []string{"https"}, AllowHosts: []string{"*.example.com"}}, "https://example.org/", false},
+		{&Policy{Schemes: []string{"https"}, AllowHosts: []string{"wiki.example.com"}}, "https://WIKI.example.com/", true},
+		{&Policy{Schemes: []string{"https"}, DenyHosts: []string{"*.internal.example.com"}}, "https://db.internal.example.com/", false},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = test.policy.CheckURL(u)
+
+		if (err == nil) != test.allowed {
+			t.Fatalf("url %s, allowed: %v, error: %v", test.url, test.allowed, err)
+		}
+
+		if err != nil && !IsBlocked(err) {
+			t.Fatalf("url %s, the error should be blocked: %v", test.url, err)
+		}
+	}
+}
+
+func TestClientDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	_, port, _ := net.SplitHostPort(u.Host)
+
+	// the host resolved to loopback is checked when dialing
+	_, err := DefaultPolicy().NewClient().Get("http://localhost:" + port)
+	if err == nil || !IsBlocked(err) {
+		t.Fatalf("localhost should be blocked when dialing, error: %v", err)
+	}
+
+	policy := DefaultPolicy()
+	policy.AllowCIDRs = []*net.IPNet{mustCIDR("127.0.0.0/8")}
+
+	resp, err := policy.NewClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewPolicyDefault(t *testing.T) {
+	shared, err := DefaultPolicy().Override(config.NewConfig(config.ConfigString(`
+		allow-private = true
+		allow-hosts   = ["*.example.com"]
+	`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetDefault(shared)
+	defer SetDefault(DefaultPolicy())
+
+	policy, err := NewPolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.AllowPrivate || len(policy.AllowHosts) != 1 {
+		t.Fatalf("the nil config should be the default policy, got %+v", policy)
+	}
+
+	// only the fields set are overridden
+	policy, err = NewPolicy(config.NewConfig(config.ConfigString(`allow-hosts = ["wiki.example.com"]`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.AllowPrivate || len(policy.AllowHosts) != 1 || policy.AllowHosts[0] != "wiki.example.com" {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+
+	if shared.AllowHosts[0] != "*.example.com" {
+		t.Fatalf("the default policy should not be changed")
+	}
+}
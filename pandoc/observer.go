@@ -0,0 +1,26 @@
+package pandoc
+
+import (
+	"time"
+)
+
+// Observer receives the events of conversions, e.g. to collect metrics
+type Observer interface {
+	// ObserveFetch is called after fetching, size is -1 if the fetcher fetched into dir
+	ObserveFetch(fetcher string, size int, duration time.Duration, err error)
+	// ObserveExec is called after the pandoc process exited
+	ObserveExec(duration time.Duration, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveFetch(string, int, time.Duration, error) {}
+func (nopObserver) ObserveExec(time.Duration, error)               {}
+
+func (p *Pandoc) SetObserver(observer Observer) {
+	if observer == nil {
+		observer = nopObserver{}
+	}
+
+	p.observer = observer
+}
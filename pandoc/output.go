@@ -0,0 +1,149 @@
+package pandoc
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+const (
+	OutputModeFile     = "file"
+	OutputModeZip      = "zip"
+	OutputModeManifest = "manifest"
+)
+
+type OutputFile struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	Data []byte `json:"data"`
+}
+
+func checkOutputMode(convertOpts ConvertOptions) (err error) {
+	switch convertOpts.OutputMode {
+	case "", OutputModeFile:
+		return
+	case OutputModeZip, OutputModeManifest:
+	default:
+		err = fmt.Errorf("output mode %s not support", convertOpts.OutputMode)
+		return
+	}
+
+	media := filepath.Clean(convertOpts.ExtractMedia)
+
+	if len(convertOpts.ExtractMedia) > 0 &&
+		(filepath.IsAbs(media) || media == "." || media == ".." || strings.HasPrefix(media, ".."+string(filepath.Separator))) {
+		err = fmt.Errorf("extract_media should be a relative sub dir in %s output mode", convertOpts.OutputMode)
+		return
+	}
+
+	return
+}
+
+// outputExt returns the extension of the output file by the format, pandoc
+// writes a directory for chunkedhtml unless the output name ends with .zip
+func outputExt(to string) string {
+	if name, _ := splitFormat(strings.ToLower(to)); name == "chunkedhtml" {
+		return "zip"
+	}
+
+	return to
+}
+
+// readOutput reads the output file of pandoc, the size is checked before reading
+func readOutput(filename string, maxSize int64) (output []byte, err error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+
+	if maxSize > 0 && fi.Size() > maxSize {
+		err = &fetcher.PayloadTooLargeError{Payload: "output", Limit: maxSize}
+		return
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+// outputFiles collects the output file and the extracted media files in dir,
+// the total size of them could not exceed maxSize
+func outputFiles(dir, outputName string, output []byte, extractMedia string, maxSize int64) (files []OutputFile, err error) {
+
+	files = append(files, OutputFile{Name: outputName, Size: len(output), Data: output})
+
+	size := int64(len(output))
+
+	if len(extractMedia) == 0 {
+		return
+	}
+
+	mediaDir := filepath.Join(dir, filepath.Clean(extractMedia))
+
+	err = filepath.Walk(mediaDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		if maxSize > 0 && size > maxSize {
+			return &fetcher.PayloadTooLargeError{Payload: "output with media files", Limit: maxSize}
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, OutputFile{Name: filepath.ToSlash(name), Size: len(data), Data: data})
+
+		return nil
+	})
+
+	return
+}
+
+func zipOutputFiles(files []OutputFile) (data []byte, err error) {
+
+	buf := bytes.NewBuffer(nil)
+
+	zw := zip.NewWriter(buf)
+
+	for _, file := range files {
+		w, e := zw.Create(file.Name)
+		if e != nil {
+			err = e
+			return
+		}
+
+		_, err = w.Write(file.Data)
+		if err != nil {
+			return
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return
+	}
+
+	data = buf.Bytes()
+
+	return
+}
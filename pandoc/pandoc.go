@@ -1,11 +1,18 @@
 package pandoc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -13,7 +20,9 @@ import (
 	"github.com/gogap/config"
 	"github.com/pborman/uuid"
 
+	"github.com/gogap/go-pandoc/pandoc/cache"
 	"github.com/gogap/go-pandoc/pandoc/fetcher"
+	"github.com/gogap/go-pandoc/pandoc/netguard"
 )
 
 type Metadata map[string][]string
@@ -63,9 +72,9 @@ type ConvertOptions struct {
 	ReferenceLinks        bool          `json:"reference_links"`
 	ReferenceLocation     string        `json:"reference_location"` // block|section|document
 	AtxHeaders            bool          `json:"atx_headers"`
-	TopLevelDivision      string        `json:"top_level_division"` // section|chapter|part
+	TopLevelDivision      string        `json:"top_level_division"` // default|section|chapter|part
 	NumberSections        bool          `json:"number_sections"`
-	NumberOffset          int           `json:"number_offset"`
+	NumberOffset          IntList       `json:"number_offset"` // 1 or [1, 2]
 	Listings              bool          `json:"listings"`
 	Incremental           bool          `json:"incremental"`
 	SlideLevel            int           `json:"slide_level"`
@@ -98,18 +107,51 @@ type ConvertOptions struct {
 	Gladtex               bool          `json:"gladtex"`
 	Abbreviations         string        `json:"abbreviations"`
 	FailIfWarnings        bool          `json:"fail_if_warnings"`
+	OutputMode            string        `json:"output_mode"` // file|zip|manifest
+	ShiftHeadingLevelBy   int           `json:"shift_heading_level_by"`
+	EmbedResources        bool          `json:"embed_resources"`
+	Citeproc              bool          `json:"citeproc"`
+	Sandbox               bool          `json:"sandbox"`
+	MarkdownHeadings      string        `json:"markdown_headings"` // atx|setext
+	ListTables            bool          `json:"list_tables"`
+	ChunkTemplate         string        `json:"chunk_template"`
+	SplitLevel            int           `json:"split_level"`
+	IpynbOutput           string        `json:"ipynb_output"` // all|none|best
+	Preset                string        `json:"preset"`       // the name of preset, the fields override it
 
 	verbose    bool
 	trace      bool
 	dumpArgs   bool
 	ignoreArgs bool
+
+	caps   *Capabilities // the args are generated for the version, nil if unknown
+	preset *Preset
+}
+
+// fileOptions is how the file options of converter are resolved
+type fileOptions struct {
+	safeDir string
+	workDir string
+	client  *http.Client
+	maxSize int64
+}
+
+func (p *fileOptions) newFile(url string) *File {
+	return &File{
+		Url:           url,
+		TempDirPrefix: "go-pandoc",
+		SafeDir:       p.safeDir,
+		WorkDir:       p.workDir,
+		Client:        p.client,
+		MaxSize:       p.maxSize,
+	}
 }
 
-func toCommandFileArgs(k, url, safeDir string) (args []string, cleanup func(), err error) {
-	f := File{Url: url, TempDirPrefix: "go-pandoc", SafeDir: safeDir}
+func toCommandFileArgs(ctx context.Context, k, url string, files fileOptions) (args []string, cleanup func(), err error) {
+	f := files.newFile(url)
 
 	var tmpFilename string
-	tmpFilename, err = f.Path()
+	tmpFilename, err = f.PathContext(ctx)
 	if err != nil {
 		return
 	}
@@ -120,7 +162,40 @@ func toCommandFileArgs(k, url, safeDir string) (args []string, cleanup func(), e
 	return
 }
 
-func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFilter bool) (ret []string, cleanups []func(), err error) {
+// RemoteURLs returns the http urls of the file options, they are
+// downloaded by the server like the http fetcher
+func (p *ConvertOptions) RemoteURLs() (urls []string) {
+	for _, v := range []string{
+		p.MetadataFile, p.Template, p.SyntaxDefinition,
+		p.IncludeInHeader, p.IncludeBeforeBody, p.IncludeAfterBody,
+		p.CSS, p.ReferenceDoc, p.EpubCoverImage, p.EpubMetadata, p.EpubEmbedFont,
+		p.Bibliography, p.CSL, p.CitationAbbreviations, p.Abbreviations,
+	} {
+		u, err := url.Parse(v)
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			urls = append(urls, v)
+		}
+	}
+
+	return
+}
+
+// the writers only link the css in the output, the css is not read by
+// pandoc unless the resources are embedded
+var cssLinkFormats = map[string]bool{
+	"html": true, "html4": true, "html5": true, "chunkedhtml": true,
+	"revealjs": true, "slidy": true, "slideous": true, "s5": true, "dzslides": true,
+}
+
+// embedsResources reports whether pandoc reads the resources, e.g. the css
+// and images, to embed them in the output, so the css is resolved like the
+// other file options instead of fetched by pandoc itself
+func (p *ConvertOptions) embedsResources() bool {
+	name, _ := splitFormat(p.To)
+	return p.EmbedResources || p.SelfContained || !cssLinkFormats[name]
+}
+
+func (p *ConvertOptions) toCommandArgs(ctx context.Context, files fileOptions, enableFilter, enableLuaFilter bool) (ret []string, cleanups []func(), err error) {
 	var args []string
 
 	var cleanupFuncs []func()
@@ -133,6 +208,25 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		}
 	}()
 
+	p.compat()
+
+	// --defaults is supported since pandoc 2.8
+	useDefaults := p.versionAtLeast(2, 8)
+
+	if useDefaults {
+		defaultsArgs, fn, e := p.defaultsArgs()
+		if e != nil {
+			err = e
+			return
+		}
+
+		args = append(args, defaultsArgs...)
+
+		if fn != nil {
+			cleanupFuncs = append(cleanupFuncs, fn)
+		}
+	}
+
 	if p.StripEmptyParagraphs {
 		args = append(args, "--strip-empty-paragraphs")
 	}
@@ -181,6 +275,22 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		args = append(args, "--atx-headers")
 	}
 
+	if p.EmbedResources {
+		args = append(args, "--embed-resources")
+	}
+
+	if p.Citeproc {
+		args = append(args, p.citeprocArgs()...)
+	}
+
+	if p.Sandbox {
+		args = append(args, "--sandbox")
+	}
+
+	if p.ListTables {
+		args = append(args, "--list-tables")
+	}
+
 	if p.NumberSections {
 		args = append(args, "--number-sections")
 	}
@@ -217,32 +327,38 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		args = append(args, "--fail-if-warnings")
 	}
 
-	for k, v := range p.Variable {
-		args = append(args, "--variable", strings.Join([]string{k, v}, "="))
-	}
+	if !useDefaults {
+		for k, v := range p.Variable {
+			args = append(args, "--variable", strings.Join([]string{k, v}, "="))
+		}
 
-	for k, values := range p.Metadata {
-		for i := 0; i < len(values); i++ {
-			args = append(args, "--metadata", strings.Join([]string{k, values[i]}, "="))
+		for k, values := range p.Metadata {
+			for i := 0; i < len(values); i++ {
+				args = append(args, "--metadata", strings.Join([]string{k, values[i]}, "="))
+			}
 		}
 	}
 
 	if len(p.MetadataFile) > 0 {
-		fileArgs, fn, e := toCommandFileArgs("--metadata-file", p.MetadataFile, safeDir)
+		fileArgs, fn, e := toCommandFileArgs(ctx, "--metadata-file", p.MetadataFile, files)
 		if e != nil {
+			err = e
 			return
 		}
-		if len(args[1]) > 0 {
+		if len(fileArgs) > 0 {
 			args = append(args, fileArgs...)
 			cleanupFuncs = append(cleanupFuncs, fn)
 		}
 	}
 
-	for k, v := range p.RequestHeader {
-		args = append(args, "--request-header", strings.Join([]string{k, v}, "="))
+	if !useDefaults {
+		for k, v := range p.RequestHeader {
+			args = append(args, "--request-header", strings.Join([]string{k, v}, "="))
+		}
 	}
 
-	if p.PDFEngine == "" {
+	// the args override the defaults, so the pdf engine of preset is kept
+	if p.PDFEngine == "" && p.preset == nil {
 		p.PDFEngine = "xelatex"
 	}
 
@@ -262,6 +378,14 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		args = append(args, "--base-header-level", strconv.Itoa(p.BaseHeaderLevel))
 	}
 
+	if p.ShiftHeadingLevelBy != 0 {
+		args = append(args, "--shift-heading-level-by", strconv.Itoa(p.ShiftHeadingLevelBy))
+	}
+
+	if len(p.MarkdownHeadings) != 0 {
+		args = append(args, "--markdown-headings", p.MarkdownHeadings)
+	}
+
 	if len(p.IndentedCodeClasses) != 0 {
 		args = append(args, "--indented-code-classes", p.IndentedCodeClasses)
 	}
@@ -287,11 +411,12 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.Template) > 0 {
-		fileArgs, fn, e := toCommandFileArgs("--template", p.Template, safeDir)
+		fileArgs, fn, e := toCommandFileArgs(ctx, "--template", p.Template, files)
 		if e != nil {
+			err = e
 			return
 		}
-		if len(args[1]) > 0 {
+		if len(fileArgs) > 0 {
 			args = append(args, fileArgs...)
 			cleanupFuncs = append(cleanupFuncs, fn)
 		}
@@ -334,44 +459,48 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.SyntaxDefinition) > 0 {
-		fileArgs, fn, e := toCommandFileArgs("--syntax-definition", p.SyntaxDefinition, safeDir)
+		fileArgs, fn, e := toCommandFileArgs(ctx, "--syntax-definition", p.SyntaxDefinition, files)
 		if e != nil {
+			err = e
 			return
 		}
-		if len(args[1]) > 0 {
+		if len(fileArgs) > 0 {
 			args = append(args, fileArgs...)
 			cleanupFuncs = append(cleanupFuncs, fn)
 		}
 	}
 
 	if len(p.IncludeInHeader) > 0 {
-		fileArgs, fn, e := toCommandFileArgs("--include-in-header", p.IncludeInHeader, safeDir)
+		fileArgs, fn, e := toCommandFileArgs(ctx, "--include-in-header", p.IncludeInHeader, files)
 		if e != nil {
+			err = e
 			return
 		}
-		if len(args[1]) > 0 {
+		if len(fileArgs) > 0 {
 			args = append(args, fileArgs...)
 			cleanupFuncs = append(cleanupFuncs, fn)
 		}
 	}
 
 	if len(p.IncludeBeforeBody) > 0 {
-		fileArgs, fn, e := toCommandFileArgs("--include-before-body", p.IncludeBeforeBody, safeDir)
+		fileArgs, fn, e := toCommandFileArgs(ctx, "--include-before-body", p.IncludeBeforeBody, files)
 		if e != nil {
+			err = e
 			return
 		}
-		if len(args[1]) > 0 {
+		if len(fileArgs) > 0 {
 			args = append(args, fileArgs...)
 			cleanupFuncs = append(cleanupFuncs, fn)
 		}
 	}
 
 	if len(p.IncludeAfterBody) > 0 {
-		fileArgs, fn, e := toCommandFileArgs("--include-after-body", p.IncludeAfterBody, safeDir)
+		fileArgs, fn, e := toCommandFileArgs(ctx, "--include-after-body", p.IncludeAfterBody, files)
 		if e != nil {
+			err = e
 			return
 		}
-		if len(args[1]) > 0 {
+		if len(fileArgs) > 0 {
 			args = append(args, fileArgs...)
 			cleanupFuncs = append(cleanupFuncs, fn)
 		}
@@ -389,8 +518,8 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		args = append(args, "--top-level-division", p.TopLevelDivision)
 	}
 
-	if p.NumberOffset != 0 {
-		args = append(args, "--number-offset", strconv.Itoa(p.NumberOffset))
+	if len(p.NumberOffset) != 0 {
+		args = append(args, "--number-offset", p.NumberOffset.String())
 	}
 
 	if p.SlideLevel != 0 {
@@ -413,14 +542,24 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		args = append(args, "--title-prefix", p.TitlePrefix)
 	}
 
-	if len(p.CSS) != 0 {
+	if len(p.CSS) != 0 && p.embedsResources() {
+		f := files.newFile(p.CSS)
+		var tmpFilename string
+		tmpFilename, err = f.PathContext(ctx)
+		if err != nil {
+			return
+		}
+
+		args = append(args, "--css", tmpFilename)
+		cleanupFuncs = append(cleanupFuncs, f.Cleanup)
+	} else if len(p.CSS) != 0 {
 		args = append(args, "--css", p.CSS)
 	}
 
 	if len(p.ReferenceDoc) > 0 {
-		f := File{Url: p.ReferenceDoc, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.ReferenceDoc)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -434,9 +573,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.EpubCoverImage) > 0 {
-		f := File{Url: p.EpubCoverImage, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.EpubCoverImage)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -446,9 +585,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.EpubMetadata) > 0 {
-		f := File{Url: p.EpubMetadata, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.EpubMetadata)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -458,9 +597,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.EpubEmbedFont) > 0 {
-		f := File{Url: p.EpubEmbedFont, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.EpubEmbedFont)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -473,6 +612,18 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 		args = append(args, "--epub-chapter-level", strconv.Itoa(p.EpubChapterLevel))
 	}
 
+	if p.SplitLevel != 0 {
+		args = append(args, "--split-level", strconv.Itoa(p.SplitLevel))
+	}
+
+	if len(p.ChunkTemplate) != 0 {
+		args = append(args, "--chunk-template", p.ChunkTemplate)
+	}
+
+	if len(p.IpynbOutput) != 0 {
+		args = append(args, "--ipynb-output", p.IpynbOutput)
+	}
+
 	if len(p.PDFEngine) != 0 {
 		args = append(args, "--pdf-engine", p.PDFEngine)
 	}
@@ -482,9 +633,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.Bibliography) > 0 {
-		f := File{Url: p.Bibliography, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.Bibliography)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -494,9 +645,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.CSL) > 0 {
-		f := File{Url: p.CSL, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.CSL)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -506,9 +657,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.CitationAbbreviations) > 0 {
-		f := File{Url: p.CitationAbbreviations, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.CitationAbbreviations)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -542,9 +693,9 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 	}
 
 	if len(p.Abbreviations) > 0 {
-		f := File{Url: p.Abbreviations, TempDirPrefix: "go-pandoc"}
+		f := files.newFile(p.Abbreviations)
 		var tmpFilename string
-		tmpFilename, err = f.Path()
+		tmpFilename, err = f.PathContext(ctx)
 		if err != nil {
 			return
 		}
@@ -573,13 +724,79 @@ func (p *ConvertOptions) toCommandArgs(safeDir string, enableFilter, enableLuaFi
 }
 
 type FetcherOptions struct {
-	Name   string          `json:"name"`   // http, oss, data
-	Params json.RawMessage `json:"params"` // Optional
+	Name    string           `json:"name"`              // http, oss, data
+	Params  json.RawMessage  `json:"params"`            // Optional
+	Sources []FetcherOptions `json:"sources,omitempty"` // fetched in parallel as the ordered inputs, e.g. chapters
+}
+
+// UnmarshalJSON accepts a list of fetcher options as the sources
+func (p *FetcherOptions) UnmarshalJSON(data []byte) (err error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		*p = FetcherOptions{}
+		return json.Unmarshal(trimmed, &p.Sources)
+	}
+
+	type fetcherOptions FetcherOptions
+
+	return json.Unmarshal(data, (*fetcherOptions)(p))
+}
+
+// Names returns the names of fetcher and the fetchers of sources
+func (p *FetcherOptions) Names() (names []string) {
+	if len(p.Name) > 0 {
+		names = append(names, p.Name)
+	}
+
+	for _, source := range p.Sources {
+		names = append(names, source.Names()...)
+	}
+
+	return
+}
+
+// Attachment is a file of the conversion, e.g. an uploaded image, it is
+// written into the work dir of pandoc by the Name
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+func (p *Attachment) writeTo(dir string) (err error) {
+	name := filepath.Clean(p.Name)
+
+	if len(p.Name) == 0 || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("attachment name '%s' is invalid", p.Name)
+		return
+	}
+
+	fname := filepath.Join(dir, name)
+
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return
+	}
+
+	err = ioutil.WriteFile(fname, p.Data, 0644)
+
+	return
+}
+
+type Result struct {
+	Data      []byte
+	Files     []OutputFile // the output file and the extracted media files in manifest output mode
+	From      string       // the input format, detected if the from of options is empty
+	QueueWait time.Duration
+	Cached    bool
 }
 
 type Pandoc struct {
 	timeout  time.Duration
 	fetchers map[string]fetcher.Fetcher
+	limiter  *limiter
+	cache    cache.Cache
+	bin      string // the pandoc binary
+	caps     *Capabilities
+	observer Observer
 
 	verbose    bool
 	trace      bool
@@ -589,27 +806,79 @@ type Pandoc struct {
 	enableFilter    bool
 	enableLuaFilter bool
 
+	// run pandoc with --sandbox, so the resources referenced in documents
+	// are not fetched by pandoc itself bypassing the network policy
+	forceSandbox bool
+
 	safeDir string
+
+	httpClient *http.Client // downloads the file options by the network policy
+
+	// the size limits in bytes, no limit if <= 0
+	maxInputSize  int64
+	maxFileSize   int64
+	maxOutputSize int64
+
+	maxSources     int
+	maxSourcesSize int64 // the total size of the sources
+
+	presets map[string]*Preset
 }
 
 func New(conf config.Configuration) (pandoc *Pandoc, err error) {
 
 	pdoc := &Pandoc{
 		fetchers: make(map[string]fetcher.Fetcher),
+		observer: nopObserver{},
 	}
 
 	commandTimeout := conf.GetTimeDuration("timeout", time.Second*300)
 
 	pdoc.timeout = commandTimeout
 
-	fetchersConf := conf.GetConfig("fetchers")
+	pdoc.limiter = newLimiter(
+		int(conf.GetInt32("max-concurrency", int32(runtime.NumCPU()))),
+		int(conf.GetInt32("queue-size", 64)),
+		conf.GetTimeDuration("queue-timeout", commandTimeout),
+	)
+
+	pdoc.cache, err = newResultCache(conf.GetConfig("cache"))
+	if err != nil {
+		return
+	}
 
-	if fetchersConf == nil || len(fetchersConf.Keys()) == 0 {
-		pandoc = pdoc
+	pdoc.presets, err = loadPresets(conf.GetConfig("presets"))
+	if err != nil {
+		return
+	}
+
+	pdoc.bin = conf.GetString("bin", "pandoc")
+
+	// the options are passed as they are if the capabilities are unknown,
+	// pandoc reports the errors of them
+	pdoc.caps, err = probeCapabilities(pdoc.bin)
+	if err != nil {
+		log.Printf("[pandoc]: probe capabilities of %s failure, the options are not validated: %s\n", pdoc.bin, err)
+		pdoc.caps, err = nil, nil
+	}
+
+	policy, err := netguard.DefaultPolicy().Override(conf.GetConfig("network"))
+	if err != nil {
 		return
 	}
 
-	fetcherList := fetchersConf.Keys()
+	// shared by the fetchers and callbacks, they override it by their own network
+	netguard.SetDefault(policy)
+
+	pdoc.httpClient = policy.NewClient()
+
+	fetchersConf := conf.GetConfig("fetchers")
+
+	var fetcherList []string
+
+	if fetchersConf != nil {
+		fetcherList = fetchersConf.Keys()
+	}
 
 	for _, fName := range fetcherList {
 
@@ -651,6 +920,7 @@ func New(conf config.Configuration) (pandoc *Pandoc, err error) {
 	pdoc.ignoreArgs = conf.GetBoolean("ignore-args")
 	pdoc.enableFilter = conf.GetBoolean("enable-filter")
 	pdoc.enableLuaFilter = conf.GetBoolean("enable-lua-filter")
+	pdoc.forceSandbox = conf.GetBoolean("force-sandbox", true)
 
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -659,53 +929,306 @@ func New(conf config.Configuration) (pandoc *Pandoc, err error) {
 
 	pdoc.safeDir = conf.GetString("safe-dir", cwd)
 
+	pdoc.maxInputSize = conf.GetInt64("max-input-size", 100<<20)
+	pdoc.maxFileSize = conf.GetInt64("max-file-size", 100<<20)
+	pdoc.maxOutputSize = conf.GetInt64("max-output-size", 500<<20)
+
+	pdoc.maxSources = int(conf.GetInt32("max-sources", 64))
+	pdoc.maxSourcesSize = conf.GetInt64("max-sources-size", 200<<20)
+
 	pandoc = pdoc
 
 	return
 }
 
+// Capabilities returns the versions, formats, extensions and highlight
+// styles of the pandoc binary
+func (p *Pandoc) Capabilities() *Capabilities {
+	return p.caps
+}
+
+// Validate checks the converter options without converting
+func (p *Pandoc) Validate(convertOpts ConvertOptions) (err error) {
+	err = p.ApplyPreset(&convertOpts)
+	if err != nil {
+		return
+	}
+
+	return p.checkOptions(convertOpts)
+}
+
+func (p *Pandoc) CacheEnabled() bool {
+	return p.cache != nil
+}
+
+func (p *Pandoc) Stats() Stats {
+	return p.limiter.Stats()
+}
+
 func (p *Pandoc) Convert(fetcherOpts FetcherOptions, convertOpts ConvertOptions) (ret []byte, err error) {
+	return p.ConvertContext(context.Background(), fetcherOpts, convertOpts)
+}
 
-	var data []byte
+// ConvertContext is the same as Convert, the fetching and the pandoc process
+// will be aborted when the ctx is done
+func (p *Pandoc) ConvertContext(ctx context.Context, fetcherOpts FetcherOptions, convertOpts ConvertOptions) (ret []byte, err error) {
+	result, err := p.RunContext(ctx, fetcherOpts, convertOpts)
+	if err != nil {
+		return
+	}
 
-	if len(convertOpts.DataDir) > 0 && !filepath.HasPrefix(convertOpts.DataDir, p.safeDir) {
-		err = fmt.Errorf("DataDir: '%s' is not in safe dir: '%s'", convertOpts.DataDir, p.safeDir)
+	ret = result.Data
+
+	return
+}
+
+func (p *Pandoc) Run(fetcherOpts FetcherOptions, convertOpts ConvertOptions) (result *Result, err error) {
+	return p.RunContext(context.Background(), fetcherOpts, convertOpts)
+}
+
+func (p *Pandoc) RunContext(ctx context.Context, fetcherOpts FetcherOptions, convertOpts ConvertOptions) (result *Result, err error) {
+
+	err = p.ApplyPreset(&convertOpts)
+	if err != nil {
+		return
+	}
+
+	err = p.checkOptions(convertOpts)
+	if err != nil {
 		return
 	}
 
-	if len(fetcherOpts.Name) == 0 {
+	if len(fetcherOpts.Sources) > 0 {
+		err = p.checkSources(fetcherOpts)
+		if err != nil {
+			return
+		}
+
+		return p.convert(ctx, convertOpts, p.sourcesInput(ctx, fetcherOpts.Sources, convertOpts.From))
+	}
+
+	f, err := p.getFetcher(fetcherOpts.Name)
+	if err != nil {
+		return
+	}
+
+	if df, ok := f.(fetcher.DirFetcher); ok {
+		return p.convert(ctx, convertOpts, func(dir string) (inputs []string, err error) {
+			return p.fetchDir(ctx, df, fetcherOpts, dir)
+		})
+	}
+
+	return p.convert(ctx, convertOpts, func(dir string) (inputs []string, err error) {
+		return p.fetchInput(ctx, f, fetcherOpts, convertOpts.From, dir, nil)
+	})
+}
+
+func (p *Pandoc) getFetcher(name string) (f fetcher.Fetcher, err error) {
+	if len(name) == 0 {
 		err = fmt.Errorf("non input method, please check your fetcher options or uri param")
 		return
 	}
 
-	if len(fetcherOpts.Name) > 0 {
-		data, err = p.fetch(fetcherOpts)
+	f, exist := p.fetchers[name]
+	if !exist {
+		err = fmt.Errorf("fetcher %s not exist", name)
+		return
+	}
+
+	return
+}
+
+func (p *Pandoc) fetchDir(ctx context.Context, df fetcher.DirFetcher, fetcherOpts FetcherOptions, dir string) (inputs []string, err error) {
+	begin := time.Now()
+	inputs, err = df.FetchDir(ctx, []byte(fetcherOpts.Params), dir)
+	p.observer.ObserveFetch(fetcherOpts.Name, -1, time.Now().Sub(begin), err)
+
+	if err != nil {
+		err = &FetchError{Fetcher: fetcherOpts.Name, Err: err}
+	}
+
+	return
+}
+
+// fetchInput streams the fetched content into the input file in dir,
+// so the document is not held in memory, the content is added to the
+// total if it is not nil
+func (p *Pandoc) fetchInput(ctx context.Context, f fetcher.Fetcher, fetcherOpts FetcherOptions, from, dir string, total *sourcesSize) (inputs []string, err error) {
+
+	begin := time.Now()
+	size := int64(0)
+
+	defer func() {
+		p.observer.ObserveFetch(fetcherOpts.Name, int(size), time.Now().Sub(begin), err)
+
+		if err != nil {
+			err = &FetchError{Fetcher: fetcherOpts.Name, Err: err}
+		}
+	}()
+
+	rc, meta, err := fetcher.Stream(ctx, f, []byte(fetcherOpts.Params))
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
+
+	if p.maxInputSize > 0 && meta.Size > p.maxInputSize {
+		err = &fetcher.PayloadTooLargeError{Payload: "input", Limit: p.maxInputSize}
+		return
+	}
+
+	input := inputName(uuid.New(), from, meta.ContentType, meta.Filename)
+
+	file, err := os.Create(filepath.Join(dir, input))
+	if err != nil {
+		return
+	}
+
+	size, err = io.Copy(file, total.reader(fetcher.LimitReader(rc, p.maxInputSize, "input")))
+
+	if e := file.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return
+	}
+
+	inputs = []string{input}
+
+	return
+}
+
+// RunDataContext converts the data directly without fetcher, the attachments
+// are written into the work dir of pandoc, so they could be referenced by
+// relative path from the document or the file options, e.g. images or template
+func (p *Pandoc) RunDataContext(ctx context.Context, data []byte, convertOpts ConvertOptions, attachments ...Attachment) (result *Result, err error) {
+
+	err = p.ApplyPreset(&convertOpts)
+	if err != nil {
+		return
+	}
+
+	err = p.checkOptions(convertOpts)
+	if err != nil {
+		return
+	}
+
+	err = p.checkInputSize(data)
+	if err != nil {
+		return
+	}
+
+	return p.convert(ctx, convertOpts, func(dir string) (inputs []string, err error) {
+		for _, attachment := range attachments {
+			err = attachment.writeTo(dir)
+			if err != nil {
+				return
+			}
+		}
+
+		return dataInput(data, convertOpts.From)(dir)
+	})
+}
+
+// inputFunc prepares the input files in the work dir of pandoc,
+// returns the input filenames relative to dir
+type inputFunc func(dir string) (inputs []string, err error)
+
+func dataInput(data []byte, from string) inputFunc {
+	return func(dir string) (inputs []string, err error) {
+		input := inputName(uuid.New(), from, "", "")
+
+		err = ioutil.WriteFile(filepath.Join(dir, input), data, 0644)
 		if err != nil {
 			return
 		}
+
+		inputs = []string{input}
+
+		return
 	}
+}
+
+func (p *Pandoc) checkOptions(convertOpts ConvertOptions) (err error) {
+	err = convertOpts.Validate(p.caps)
+	if err != nil {
+		return
+	}
+
+	if len(convertOpts.DataDir) > 0 && !inSafeDir(p.safeDir, convertOpts.DataDir) {
+		err = fmt.Errorf("DataDir: '%s' is not in safe dir: '%s'", convertOpts.DataDir, p.safeDir)
+		return
+	}
+
+	err = checkOutputMode(convertOpts)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (p *Pandoc) checkInputSize(data []byte) (err error) {
+	if p.maxInputSize > 0 && int64(len(data)) > p.maxInputSize {
+		err = &fetcher.PayloadTooLargeError{Payload: "input", Limit: p.maxInputSize}
+		return
+	}
+
+	return
+}
+
+func (p *Pandoc) convert(ctx context.Context, convertOpts ConvertOptions, input inputFunc) (result *Result, err error) {
 
 	tmpDir, err := ioutil.TempDir("", "go-pandoc")
 	if err != nil {
 		return
 	}
 
-	tmpInput := filepath.Join(tmpDir, uuid.New()) + "." + convertOpts.From
-	tmpOutpout := filepath.Join(tmpDir, uuid.New()) + "." + convertOpts.To
+	defer os.RemoveAll(tmpDir)
 
-	err = ioutil.WriteFile(tmpInput, data, 0644)
+	inputs, err := input(tmpDir)
 	if err != nil {
 		return
 	}
 
-	defer os.Remove(tmpInput)
+	if len(inputs) == 0 {
+		err = fmt.Errorf("non input file fetched")
+		return
+	}
+
+	// all inputs should be the same format as the first one
+	if len(convertOpts.From) == 0 {
+		convertOpts.From, err = detectFormat(filepath.Join(tmpDir, inputs[0]))
+		if err != nil {
+			return
+		}
+	}
+
+	convertOpts.ResourcePath = resourcePath(convertOpts.ResourcePath, inputs)
+
+	tmpOutpout := filepath.Join(tmpDir, uuid.New()) + "." + outputExt(convertOpts.To)
 
 	convertOpts.verbose = p.verbose
 	convertOpts.trace = p.trace
 	convertOpts.dumpArgs = p.dumpArgs
 	convertOpts.ignoreArgs = p.ignoreArgs
+	convertOpts.caps = p.caps
 
-	args, cleanupFuncs, err := convertOpts.toCommandArgs(p.safeDir, p.enableFilter, p.enableLuaFilter)
+	// --sandbox is supported since pandoc 2.15, it is not forced if the version is unknown
+	if p.forceSandbox && p.caps != nil && p.caps.VersionAtLeast(2, 15) {
+		convertOpts.Sandbox = true
+	}
+
+	fileOpts := fileOptions{
+		safeDir: p.safeDir,
+		workDir: tmpDir,
+		client:  p.httpClient,
+		maxSize: p.maxFileSize,
+	}
+
+	args, cleanupFuncs, err := convertOpts.toCommandArgs(ctx, fileOpts, p.enableFilter, p.enableLuaFilter)
 	if err != nil {
 		return
 	}
@@ -718,32 +1241,101 @@ func (p *Pandoc) Convert(fetcherOpts FetcherOptions, convertOpts ConvertOptions)
 		}()
 	}
 
-	args = append(args, []string{"--quiet", tmpInput, "--output", tmpOutpout}...)
+	var cacheKey string
 
-	_, err = execCommand(p.timeout, "pandoc", args...)
+	if p.cache != nil && cacheable(tmpDir, inputs, convertOpts) {
+		cacheKey, err = p.cacheKey(tmpDir, inputs, convertOpts, args)
+		if err != nil {
+			return
+		}
+
+		if cached, hit := p.getCachedResult(cacheKey); hit {
+			cached.From = convertOpts.From
+			result = cached
+			return
+		}
 
+		defer func() {
+			if err == nil {
+				p.setCachedResult(cacheKey, result)
+			}
+		}()
+	}
+
+	args = append(args, "--quiet")
+	args = append(args, inputs...)
+	args = append(args, "--output", tmpOutpout)
+
+	queueWait, err := p.limiter.Acquire(ctx)
 	if err != nil {
 		return
 	}
 
-	defer os.Remove(tmpOutpout)
+	execBegin := time.Now()
 
-	var result []byte
-	result, err = ioutil.ReadFile(tmpOutpout)
+	_, err = execCommand(ctx, p.timeout, tmpDir, p.bin, args...)
 
-	ret = result
+	p.limiter.Release()
 
-	return
-}
+	p.observer.ObserveExec(time.Now().Sub(execBegin), err)
 
-func (p *Pandoc) fetch(fetcherOpts FetcherOptions) (data []byte, err error) {
-	fetcher, exist := p.fetchers[fetcherOpts.Name]
-	if !exist {
-		err = fmt.Errorf("fetcher %s not exist", fetcherOpts.Name)
+	if err != nil {
+		err = latexError(err, convertOpts.PDFEngine)
 		return
 	}
 
-	data, err = fetcher.Fetch([]byte(fetcherOpts.Params))
+	output, err := readOutput(tmpOutpout, p.maxOutputSize)
+	if err != nil {
+		return
+	}
+
+	result = &Result{
+		From:      convertOpts.From,
+		QueueWait: queueWait,
+	}
+
+	if convertOpts.OutputMode != OutputModeZip && convertOpts.OutputMode != OutputModeManifest {
+		result.Data = output
+		return
+	}
+
+	files, err := outputFiles(tmpDir, "output."+outputExt(convertOpts.To), output, convertOpts.ExtractMedia, p.maxOutputSize)
+	if err != nil {
+		return
+	}
+
+	if convertOpts.OutputMode == OutputModeManifest {
+		result.Files = files
+		return
+	}
+
+	result.Data, err = zipOutputFiles(files)
 
 	return
 }
+
+// resourcePath appends the dirs of inputs to the resource path, so the
+// resources could be found relative to the input files in sub dirs
+func resourcePath(resourcePath string, inputs []string) string {
+	paths := []string{"."}
+
+	if len(resourcePath) > 0 {
+		paths = []string{resourcePath}
+	}
+
+	exist := map[string]bool{".": true}
+
+	for _, input := range inputs {
+		dir := filepath.Dir(input)
+		if !exist[dir] {
+			exist[dir] = true
+			paths = append(paths, dir)
+		}
+	}
+
+	if len(exist) == 1 {
+		return resourcePath
+	}
+
+	return strings.Join(paths, string(os.PathListSeparator))
+}
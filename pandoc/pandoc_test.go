@@ -0,0 +1,324 @@
+package pandoc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+	"github.com/gogap/go-pandoc/pandoc/netguard"
+)
+
+func TestToCommandArgsDeniedFileOption(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("$body$"))
+	}))
+	defer srv.Close()
+
+	files := fileOptions{
+		workDir: t.TempDir(),
+		client:  netguard.DefaultPolicy().NewClient(),
+	}
+
+	tests := []ConvertOptions{
+		{To: "html", Template: srv.URL + "/template.html"},
+		{To: "html", MetadataFile: srv.URL + "/metadata.yaml"},
+		{To: "html", IncludeInHeader: srv.URL + "/header.html"},
+		{To: "html", SyntaxDefinition: srv.URL + "/syntax.xml"},
+		{To: "html", CSS: srv.URL + "/style.css", EmbedResources: true},
+		{To: "html", CSS: srv.URL + "/style.css", SelfContained: true},
+		{To: "epub", CSS: srv.URL + "/style.css"},
+		{To: "html", CSS: "http://100.100.100.200/style.css", EmbedResources: true},
+	}
+
+	for _, opts := range tests {
+		args, cleanups, err := opts.toCommandArgs(context.Background(), files, false, false)
+		if err == nil {
+			t.Fatalf("the loopback url should be denied, args: %v", args)
+		}
+
+		if len(cleanups) > 0 {
+			t.Fatalf("the cleanups should be done on error")
+		}
+	}
+}
+
+func TestToCommandArgsFileOption(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("title: test"))
+	}))
+	defer srv.Close()
+
+	policy := netguard.DefaultPolicy()
+	policy.AllowPrivate = true
+
+	files := fileOptions{
+		workDir: t.TempDir(),
+		client:  policy.NewClient(),
+	}
+
+	// the file option is the first arg
+	opts := ConvertOptions{To: "html", MetadataFile: srv.URL + "/metadata.yaml"}
+
+	args, cleanups, err := opts.toCommandArgs(context.Background(), files, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		for _, fn := range cleanups {
+			fn()
+		}
+	}()
+
+	if len(args) < 2 || args[0] != "--metadata-file" || len(cleanups) != 1 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func TestToCommandArgsCSS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("body {}"))
+	}))
+	defer srv.Close()
+
+	policy := netguard.DefaultPolicy()
+	policy.AllowPrivate = true
+
+	files := fileOptions{
+		workDir: t.TempDir(),
+		client:  policy.NewClient(),
+	}
+
+	css := srv.URL + "/style.css"
+
+	tests := []struct {
+		opts     ConvertOptions
+		resolved bool
+	}{
+		{ConvertOptions{To: "html", CSS: css}, false},
+		{ConvertOptions{To: "revealjs", CSS: css}, false},
+		{ConvertOptions{To: "html5+smart", CSS: css, EmbedResources: true}, true},
+		{ConvertOptions{To: "html", CSS: css, SelfContained: true}, true},
+		{ConvertOptions{To: "epub", CSS: css}, true},
+	}
+
+	for _, test := range tests {
+		args, cleanups, err := test.opts.toCommandArgs(context.Background(), files, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, fn := range cleanups {
+			defer fn()
+		}
+
+		value := ""
+		for i := range args {
+			if args[i] == "--css" && i+1 < len(args) {
+				value = args[i+1]
+			}
+		}
+
+		if resolved := value != css; resolved != test.resolved || len(value) == 0 {
+			t.Fatalf("%s: unexpected css %s", test.opts.To, value)
+		}
+	}
+}
+
+// fakePandoc returns a pandoc with a shell script as the binary, the script
+// reads the args to $1, $2..., and writes the output by the body, all the
+// args are in $args
+func fakePandoc(t *testing.T, body string) *Pandoc {
+	bin := filepath.Join(t.TempDir(), "pandoc")
+
+	script := "#!/bin/sh\n" +
+		"args=\"$*\"\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  case \"$1\" in\n" +
+		"    --output) output=\"$2\"; shift;;\n" +
+		"    --metadata-file) metadata=\"$2\"; shift;;\n" +
+		"  esac\n" +
+		"  shift\n" +
+		"done\n" + body + "\n"
+
+	err := ioutil.WriteFile(bin, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Pandoc{
+		timeout:  10 * time.Second,
+		fetchers: map[string]fetcher.Fetcher{},
+		limiter:  newLimiter(1, 0, 0),
+		bin:      bin,
+		observer: nopObserver{},
+	}
+}
+
+func TestRunDataAttachmentFileOption(t *testing.T) {
+	pdoc := fakePandoc(t, `cat "$metadata" > "$output"`)
+
+	attachment := Attachment{Name: "metadata_file/meta.yaml", Data: []byte("title: report")}
+
+	result, err := pdoc.RunDataContext(context.Background(), []byte("# report"),
+		ConvertOptions{From: "markdown", To: "html", MetadataFile: attachment.Name}, attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result.Data) != "title: report" {
+		t.Fatalf("the metadata file should be the attachment, got %q", result.Data)
+	}
+}
+
+func TestRunDataChunkedHTML(t *testing.T) {
+	// pandoc writes a directory unless the output name ends with .zip
+	pdoc := fakePandoc(t, `case "$output" in *.zip) printf zip > "$output";; *) mkdir "$output";; esac`)
+
+	tests := []struct {
+		opts ConvertOptions
+		name string
+	}{
+		{ConvertOptions{From: "markdown", To: "chunkedhtml"}, ""},
+		{ConvertOptions{From: "markdown", To: "chunkedhtml", OutputMode: OutputModeManifest}, "output.zip"},
+	}
+
+	for _, test := range tests {
+		result, err := pdoc.RunDataContext(context.Background(), []byte("# report"), test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(test.name) == 0 && string(result.Data) != "zip" {
+			t.Fatalf("the output should be the zip, got %q", result.Data)
+		}
+
+		if len(test.name) > 0 && (len(result.Files) != 1 || result.Files[0].Name != test.name || string(result.Files[0].Data) != "zip") {
+			t.Fatalf("the output file should be %s, got %+v", test.name, result.Files)
+		}
+	}
+}
+
+func TestNewWithoutPandoc(t *testing.T) {
+	defer netguard.SetDefault(netguard.DefaultPolicy())
+
+	pdoc, err := New(config.NewConfig(config.ConfigString(`bin = "` + filepath.Join(t.TempDir(), "pandoc") + `"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pdoc.Capabilities() != nil {
+		t.Fatalf("the capabilities should be unknown")
+	}
+
+	// the options are not validated by the capabilities
+	err = pdoc.Validate(ConvertOptions{From: "markdown", To: "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sizeFetcher fetches the zeros of the size in params, it writes a file
+// into dir as a DirFetcher
+type sizeFetcher struct{}
+
+func (sizeFetcher) Fetch(params fetcher.FetchParams) (data []byte, err error) {
+	size := 0
+	err = params.Unmarshal(&size)
+	if err != nil {
+		return
+	}
+
+	data = make([]byte, size)
+
+	return
+}
+
+type sizeDirFetcher struct{ sizeFetcher }
+
+func (p sizeDirFetcher) FetchDir(ctx context.Context, params fetcher.FetchParams, dir string) (inputs []string, err error) {
+	data, err := p.Fetch(params)
+	if err != nil {
+		return
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "input.md"), data, 0644)
+	if err != nil {
+		return
+	}
+
+	inputs = []string{"input.md"}
+
+	return
+}
+
+func TestRunSourcesSize(t *testing.T) {
+	pdoc := fakePandoc(t, `printf ok > "$output"`)
+	pdoc.fetchers["size"] = sizeFetcher{}
+	pdoc.fetchers["dir"] = sizeDirFetcher{}
+	pdoc.maxSourcesSize = 100
+
+	tests := []struct {
+		sources  string
+		tooLarge bool
+	}{
+		{`[{"name": "size", "params": 50}, {"name": "dir", "params": 50}]`, false},
+		{`[{"name": "size", "params": 60}, {"name": "size", "params": 60}]`, true},
+		{`[{"name": "dir", "params": 60}, {"name": "dir", "params": 60}]`, true},
+		{`[{"name": "size", "params": 60}, {"name": "dir", "params": 60}]`, true},
+	}
+
+	for _, test := range tests {
+		fetcherOpts := FetcherOptions{}
+
+		err := json.Unmarshal([]byte(test.sources), &fetcherOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = pdoc.RunContext(context.Background(), fetcherOpts, ConvertOptions{From: "markdown", To: "html"})
+		if fetcher.IsPayloadTooLarge(err) != test.tooLarge {
+			t.Fatalf("%s: unexpected error: %v", test.sources, err)
+		}
+
+		if !test.tooLarge && err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunForceSandbox(t *testing.T) {
+	pdoc := fakePandoc(t, `printf "%s" "$args" > "$output"`)
+	pdoc.forceSandbox = true
+
+	tests := []struct {
+		caps    *Capabilities
+		sandbox bool
+	}{
+		{&Capabilities{Version: "3.1.9"}, true},
+		{&Capabilities{Version: "2.15"}, true},
+		{&Capabilities{Version: "2.14.2"}, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		pdoc.caps = test.caps
+
+		result, err := pdoc.RunDataContext(context.Background(), []byte("# report"), ConvertOptions{From: "markdown", To: "html"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sandbox := strings.Contains(string(result.Data), "--sandbox"); sandbox != test.sandbox {
+			t.Fatalf("%+v: unexpected args %s", test.caps, result.Data)
+		}
+	}
+}
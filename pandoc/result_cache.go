@@ -0,0 +1,234 @@
+package pandoc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gogap/config"
+
+	"github.com/gogap/go-pandoc/pandoc/cache"
+)
+
+// the args which value is a file, the content of the file is a part of the cache key
+var fileOptionFlags = map[string]bool{
+	"--defaults":               true,
+	"--metadata-file":          true,
+	"--template":               true,
+	"--syntax-definition":      true,
+	"--include-in-header":      true,
+	"--include-before-body":    true,
+	"--include-after-body":     true,
+	"--reference-doc":          true,
+	"--epub-cover-image":       true,
+	"--epub-metadata":          true,
+	"--epub-embed-font":        true,
+	"--bibliography":           true,
+	"--csl":                    true,
+	"--citation-abbreviations": true,
+	"--abbreviations":          true,
+}
+
+// the filters are found in PATH if they are not paths, the contents of them
+// are a part of the cache key, so the redeployed filters are not stale
+var filterFlags = map[string]bool{
+	"--filter":     true,
+	"--lua-filter": true,
+}
+
+var remoteURLRegexp = regexp.MustCompile(`(?i)https?://`)
+
+type cachedResult struct {
+	Data  []byte       `json:"data"`
+	Files []OutputFile `json:"files"`
+}
+
+func newResultCache(conf config.Configuration) (c cache.Cache, err error) {
+
+	if conf == nil || !conf.GetBoolean("enabled", false) {
+		return
+	}
+
+	memCache := cache.NewMemoryCache(conf.GetInt64("max-size", 256<<20))
+
+	dir := conf.GetString("dir")
+
+	if len(dir) == 0 {
+		c = memCache
+		return
+	}
+
+	diskCache, err := cache.NewDiskCache(dir, conf.GetInt64("dir-max-size", 1<<30))
+	if err != nil {
+		err = fmt.Errorf("create cache dir %s failure, error: %s", dir, err)
+		return
+	}
+
+	c = cache.Chain(memCache, diskCache)
+
+	return
+}
+
+// cacheKey hashes the pandoc version, the options, the files in work dir
+// and the contents of the file options
+func (p *Pandoc) cacheKey(dir string, inputs []string, convertOpts ConvertOptions, args []string) (key string, err error) {
+
+	h := sha256.New()
+
+	if p.caps != nil {
+		fmt.Fprintf(h, "version:%s\n", p.caps.VersionInfo)
+	}
+
+	opts, err := json.Marshal(convertOpts)
+	if err != nil {
+		return
+	}
+
+	h.Write(opts)
+
+	inputIndex := map[string]int{}
+	for i, input := range inputs {
+		inputIndex[filepath.Clean(input)] = i
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		// the data input is named randomly, use the index instead
+		if i, ok := inputIndex[name]; ok {
+			name = fmt.Sprintf("input:%d", i)
+		}
+
+		fmt.Fprintf(h, "\nfile:%s\n", name)
+
+		return hashFile(h, path)
+	})
+
+	if err != nil {
+		return
+	}
+
+	for i := 0; i+1 < len(args); i++ {
+		fname := ""
+
+		switch {
+		case fileOptionFlags[args[i]]:
+			fname = args[i+1]
+		case args[i] == "--css" && convertOpts.embedsResources():
+			// the css is resolved to a file, otherwise the url is only linked
+			fname = args[i+1]
+		case filterFlags[args[i]]:
+			fname = filterPath(dir, args[i+1])
+		}
+
+		if len(fname) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(h, "\n%s\n", args[i])
+
+		err = hashFile(h, fname)
+		if err != nil {
+			return
+		}
+	}
+
+	key = hex.EncodeToString(h.Sum(nil))
+
+	return
+}
+
+// filterPath returns the path of filter, the relative path is in the work
+// dir, otherwise it is found in PATH, it is empty if not found
+func filterPath(dir, name string) string {
+	if !filepath.IsAbs(name) {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return filepath.Join(dir, name)
+		}
+	} else if _, err := os.Stat(name); err == nil {
+		return name
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+
+	return ""
+}
+
+// cacheable reports whether the output only depends on the cache key, the
+// remote resources in documents are fetched by pandoc itself when embedding
+// them out of the sandbox, they are not a part of the key
+func cacheable(dir string, inputs []string, convertOpts ConvertOptions) bool {
+	if convertOpts.Sandbox || !convertOpts.embedsResources() {
+		return true
+	}
+
+	for _, input := range inputs {
+		data, err := ioutil.ReadFile(filepath.Join(dir, input))
+		if err != nil || remoteURLRegexp.Match(data) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hashFile(h hash.Hash, fname string) (err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+
+	return
+}
+
+func (p *Pandoc) getCachedResult(key string) (result *Result, ok bool) {
+	data, ok := p.cache.Get(key)
+	if !ok {
+		return
+	}
+
+	cached := cachedResult{}
+
+	if err := json.Unmarshal(data, &cached); err != nil {
+		ok = false
+		return
+	}
+
+	result = &Result{
+		Data:   cached.Data,
+		Files:  cached.Files,
+		Cached: true,
+	}
+
+	return
+}
+
+func (p *Pandoc) setCachedResult(key string, result *Result) {
+	data, err := json.Marshal(cachedResult{Data: result.Data, Files: result.Files})
+	if err != nil {
+		return
+	}
+
+	p.cache.Set(key, data)
+}
@@ -0,0 +1,106 @@
+package pandoc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheKeyFileContents(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "input.md"), []byte("# report"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdoc := &Pandoc{}
+
+	tests := []struct {
+		opts  ConvertOptions
+		flag  string
+		fname string // the file changed after the first key
+	}{
+		{ConvertOptions{To: "html", LuaFilter: "filter.lua"}, "--lua-filter", filepath.Join(other, "filter.lua")},
+		{ConvertOptions{To: "html", LuaFilter: "filter.lua"}, "--lua-filter", filepath.Join(dir, "filter.lua")},
+		{ConvertOptions{To: "html", Filter: "filter.py"}, "--filter", filepath.Join(other, "filter.py")},
+		{ConvertOptions{To: "html", EmbedResources: true}, "--css", filepath.Join(other, "style.css")},
+		{ConvertOptions{To: "html"}, "--template", filepath.Join(other, "template.html")},
+	}
+
+	for _, test := range tests {
+		err := ioutil.WriteFile(test.fname, []byte("v1"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arg := test.fname
+		if filepath.Dir(arg) == dir {
+			arg = filepath.Base(arg)
+		}
+
+		args := []string{test.flag, arg}
+
+		key1, err := pdoc.cacheKey(dir, []string{"input.md"}, test.opts, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(test.fname, []byte("v2"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key2, err := pdoc.cacheKey(dir, []string{"input.md"}, test.opts, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if key1 == key2 {
+			t.Fatalf("%s %s: the key should be changed with the contents", test.flag, arg)
+		}
+	}
+
+	// the linked css is not read
+	_, err = pdoc.cacheKey(dir, []string{"input.md"}, ConvertOptions{To: "html"}, []string{"--css", "https://example.com/style.css"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	dir := t.TempDir()
+
+	inputs := map[string]string{
+		"local.md":  "# report\n\n![chart](images/chart.png)",
+		"remote.md": "# report\n\n![chart](https://example.com/chart.png)",
+	}
+
+	for name, data := range inputs {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input     string
+		opts      ConvertOptions
+		cacheable bool
+	}{
+		{"remote.md", ConvertOptions{To: "html"}, true},
+		{"remote.md", ConvertOptions{To: "html", EmbedResources: true}, false},
+		{"remote.md", ConvertOptions{To: "html", SelfContained: true}, false},
+		{"remote.md", ConvertOptions{To: "docx"}, false},
+		{"remote.md", ConvertOptions{To: "docx", Sandbox: true}, true},
+		{"local.md", ConvertOptions{To: "docx"}, true},
+		{"local.md", ConvertOptions{To: "html", EmbedResources: true}, true},
+	}
+
+	for _, test := range tests {
+		if cacheable(dir, []string{test.input}, test.opts) != test.cacheable {
+			t.Fatalf("%s %+v should be cacheable: %v", test.input, test.opts, test.cacheable)
+		}
+	}
+}
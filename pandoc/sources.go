@@ -0,0 +1,198 @@
+package pandoc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
+)
+
+func (p *Pandoc) checkSources(fetcherOpts FetcherOptions) (err error) {
+	if len(fetcherOpts.Name) > 0 {
+		err = fmt.Errorf("fetcher name and sources could not be both set")
+		return
+	}
+
+	if p.maxSources > 0 && len(fetcherOpts.Sources) > p.maxSources {
+		err = fmt.Errorf("too many sources, the limit is %d", p.maxSources)
+		return
+	}
+
+	for _, source := range fetcherOpts.Sources {
+		if len(source.Sources) > 0 {
+			err = fmt.Errorf("sources of fetcher could not be nested")
+			return
+		}
+
+		_, err = p.getFetcher(source.Name)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// sourcesInput fetches the sources in parallel, each source is fetched into
+// its own sub dir, so the files of different sources are not overwritten,
+// the inputs are in the order of sources
+func (p *Pandoc) sourcesInput(ctx context.Context, sources []FetcherOptions, from string) inputFunc {
+	return func(dir string) (inputs []string, err error) {
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		sourceInputs := make([][]string, len(sources))
+
+		total := &sourcesSize{limit: p.maxSourcesSize}
+
+		wg := sync.WaitGroup{}
+		errOnce := sync.Once{}
+
+		for i := range sources {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				names, e := p.fetchSource(ctx, sources[i], from, dir, fmt.Sprintf("source-%d", i), total)
+
+				if e != nil {
+					// the first error is the cause, the other sources are
+					// useless and cancelled
+					errOnce.Do(func() {
+						err = fmt.Errorf("source %d: %w", i, e)
+						cancel()
+					})
+					return
+				}
+
+				sourceInputs[i] = names
+			}(i)
+		}
+
+		wg.Wait()
+
+		if err != nil {
+			return
+		}
+
+		for _, names := range sourceInputs {
+			inputs = append(inputs, names...)
+		}
+
+		return
+	}
+}
+
+// fetchSource fetches the source into the sub dir, returns the inputs relative to dir,
+// the size of the source is added to the total
+func (p *Pandoc) fetchSource(ctx context.Context, source FetcherOptions, from, dir, subDir string, total *sourcesSize) (inputs []string, err error) {
+
+	f, err := p.getFetcher(source.Name)
+	if err != nil {
+		return
+	}
+
+	err = os.Mkdir(filepath.Join(dir, subDir), 0755)
+	if err != nil {
+		return
+	}
+
+	if df, ok := f.(fetcher.DirFetcher); ok {
+		inputs, err = p.fetchDir(ctx, df, source, filepath.Join(dir, subDir))
+		if err == nil {
+			err = total.addDir(filepath.Join(dir, subDir))
+		}
+	} else {
+		inputs, err = p.fetchInput(ctx, f, source, from, filepath.Join(dir, subDir), total)
+	}
+
+	if err != nil {
+		return
+	}
+
+	for i := range inputs {
+		inputs[i] = filepath.Join(subDir, inputs[i])
+	}
+
+	return
+}
+
+// sourcesSize is the total size of the fetched sources, it is shared by
+// the sources fetched in parallel, the limit <= 0 means no limit
+type sourcesSize struct {
+	limit int64
+	size  int64
+}
+
+func (p *sourcesSize) add(n int64) (err error) {
+	if p == nil || p.limit <= 0 {
+		return
+	}
+
+	if atomic.AddInt64(&p.size, n) > p.limit {
+		err = &fetcher.PayloadTooLargeError{Payload: "sources", Limit: p.limit}
+	}
+
+	return
+}
+
+// addDir adds the size of the files in dir, the dir fetchers write the
+// files by themselves, so they are counted after fetching
+func (p *sourcesSize) addDir(dir string) (err error) {
+	if p == nil || p.limit <= 0 {
+		return
+	}
+
+	size := int64(0)
+
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	return p.add(size)
+}
+
+// reader returns a reader of r which adds the read bytes to the total size
+func (p *sourcesSize) reader(r io.Reader) io.Reader {
+	if p == nil || p.limit <= 0 {
+		return r
+	}
+
+	return &sourcesSizeReader{r: r, total: p}
+}
+
+type sourcesSizeReader struct {
+	r     io.Reader
+	total *sourcesSize
+}
+
+func (p *sourcesSizeReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+
+	if n > 0 {
+		if e := p.total.add(int64(n)); e != nil {
+			err = e
+		}
+	}
+
+	return
+}
@@ -0,0 +1,221 @@
+package pandoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is an invalid field of converter options, the field is the json name
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError contains all the invalid fields of converter options
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (p *ValidationError) Error() string {
+	msgs := make([]string, 0, len(p.Fields))
+	for _, f := range p.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+
+	return "invalid converter options, " + strings.Join(msgs, "; ")
+}
+
+func (p *ValidationError) add(field, format string, args ...interface{}) {
+	p.Fields = append(p.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// IsValidationError reports whether err is returned by Validate
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+var enumOptions = []struct {
+	field  string
+	value  func(*ConvertOptions) string
+	values []string
+}{
+	{"track_changes", func(p *ConvertOptions) string { return p.TrackChanges }, []string{"accept", "reject", "all"}},
+	{"eol", func(p *ConvertOptions) string { return p.EOL }, []string{"crlf", "lf", "native"}},
+	{"wrap", func(p *ConvertOptions) string { return p.Wrap }, []string{"auto", "none", "preserve"}},
+	{"reference_location", func(p *ConvertOptions) string { return p.ReferenceLocation }, []string{"block", "section", "document"}},
+	{"top_level_division", func(p *ConvertOptions) string { return p.TopLevelDivision }, []string{"default", "section", "chapter", "part"}},
+	{"email_obfuscation", func(p *ConvertOptions) string { return p.EmailObfuscation }, []string{"none", "javascript", "references"}},
+	{"markdown_headings", func(p *ConvertOptions) string { return p.MarkdownHeadings }, []string{"atx", "setext"}},
+	{"ipynb_output", func(p *ConvertOptions) string { return p.IpynbOutput }, []string{"all", "none", "best"}},
+}
+
+// the zero value is not set, so it is always valid
+var rangeOptions = []struct {
+	field    string
+	value    func(*ConvertOptions) int
+	min, max int // max < 0 is unlimited
+}{
+	{"base_header_level", func(p *ConvertOptions) int { return p.BaseHeaderLevel }, 1, 6},
+	{"tab_stop", func(p *ConvertOptions) int { return p.TabStop }, 1, -1},
+	{"dpi", func(p *ConvertOptions) int { return p.DPI }, 1, -1},
+	{"columns", func(p *ConvertOptions) int { return p.Columns }, 1, -1},
+	{"toc_depth", func(p *ConvertOptions) int { return p.TOCDepth }, 1, 6},
+	{"slide_level", func(p *ConvertOptions) int { return p.SlideLevel }, 1, 6},
+	{"epub_chapter_level", func(p *ConvertOptions) int { return p.EpubChapterLevel }, 1, 6},
+	{"split_level", func(p *ConvertOptions) int { return p.SplitLevel }, 1, 6},
+}
+
+// the options could not be translated for the old pandoc
+var versionOptions = []struct {
+	field   string
+	used    func(*ConvertOptions) bool
+	version []int
+}{
+	{"ipynb_output", func(p *ConvertOptions) bool { return len(p.IpynbOutput) > 0 }, []int{2, 6}},
+	{"shift_heading_level_by", func(p *ConvertOptions) bool { return p.ShiftHeadingLevelBy < 0 }, []int{2, 8}},
+	{"sandbox", func(p *ConvertOptions) bool { return p.Sandbox }, []int{2, 15}},
+	{"chunk_template", func(p *ConvertOptions) bool { return len(p.ChunkTemplate) > 0 }, []int{3}},
+	{"preset", func(p *ConvertOptions) bool { return len(p.Preset) > 0 }, []int{2, 8}},
+}
+
+// Validate checks the options before fetching, the formats and extensions
+// are checked by caps if it is not nil, all the invalid fields are
+// returned by a *ValidationError
+func (p *ConvertOptions) Validate(caps *Capabilities) (err error) {
+
+	verr := &ValidationError{}
+
+	if caps != nil {
+		caps.checkFormat(verr, "from", p.From, caps.inputFormats)
+		caps.checkFormat(verr, "to", p.To, caps.outputFormats)
+
+		for _, opt := range versionOptions {
+			if opt.used(p) && len(caps.Version) > 0 && !caps.VersionAtLeast(opt.version...) {
+				verr.add(opt.field, "requires pandoc %s, the version is %s",
+					strings.Replace(IntList(opt.version).String(), ",", ".", -1), caps.Version)
+			}
+		}
+	}
+
+	for _, opt := range enumOptions {
+		if v := opt.value(p); len(v) > 0 && !contains(opt.values, v) {
+			verr.add(opt.field, "%s is invalid, should be one of %s", v, strings.Join(opt.values, "|"))
+		}
+	}
+
+	for _, opt := range rangeOptions {
+		v := opt.value(p)
+		if v == 0 {
+			continue
+		}
+
+		if opt.max < 0 && v < opt.min {
+			verr.add(opt.field, "%d is invalid, should be at least %d", v, opt.min)
+		} else if opt.max >= 0 && (v < opt.min || v > opt.max) {
+			verr.add(opt.field, "%d is invalid, should be between %d and %d", v, opt.min, opt.max)
+		}
+	}
+
+	for _, v := range p.NumberOffset {
+		if v < 0 {
+			verr.add("number_offset", "%d is invalid, should not be negative", v)
+		}
+	}
+
+	checkExclusive(verr, map[string]bool{
+		"mathml":      p.Mathml,
+		"webtex":      len(p.Webtex) > 0,
+		"mathjax":     len(p.Mathjax) > 0,
+		"katex":       len(p.Katex) > 0,
+		"latexmathml": len(p.Latexmathml) > 0,
+		"mimetex":     len(p.Mimetex) > 0,
+		"jsmath":      len(p.Jsmath) > 0,
+		"gladtex":     p.Gladtex,
+	}, "mathml", "webtex", "mathjax", "katex", "latexmathml", "mimetex", "jsmath", "gladtex")
+
+	checkExclusive(verr, map[string]bool{
+		"natbib":   p.Natbib,
+		"biblatex": p.Biblatex,
+	}, "natbib", "biblatex")
+
+	if len(verr.Fields) > 0 {
+		err = verr
+	}
+
+	return
+}
+
+// checkExclusive reports the fields used with the first one of the set fields,
+// the fields are in order so the errors are stable
+func checkExclusive(verr *ValidationError, set map[string]bool, fields ...string) {
+	first := ""
+	for _, field := range fields {
+		if !set[field] {
+			continue
+		}
+
+		if len(first) == 0 {
+			first = field
+			continue
+		}
+
+		verr.add(field, "could not be used with %s", first)
+	}
+}
+
+// checkFormat checks the format name and the extensions, e.g. markdown+smart-raw_html,
+// the custom lua readers and writers are not checked, pdf is produced by the
+// pdf engine so it is not in the output formats
+func (p *Capabilities) checkFormat(verr *ValidationError, field, format string, formats map[string]bool) {
+	if len(format) == 0 || strings.HasSuffix(format, ".lua") {
+		return
+	}
+
+	name, exts := splitFormat(format)
+
+	if len(formats) > 0 && !formats[name] && !(field == "to" && name == "pdf") {
+		verr.add(field, "format %s is not supported by pandoc %s", name, p.Version)
+		return
+	}
+
+	for _, ext := range exts {
+		if len(ext) == 1 {
+			verr.add(field, "extension of format %s is empty", format)
+			continue
+		}
+
+		if len(p.extensions) > 0 && !p.extensions[ext[1:]] {
+			verr.add(field, "extension %s is not supported by pandoc %s", ext[1:], p.Version)
+		}
+	}
+}
+
+// splitFormat splits the format name and the extensions with +/- prefix
+func splitFormat(format string) (name string, exts []string) {
+	idx := strings.IndexAny(format, "+-")
+	if idx < 0 {
+		return format, nil
+	}
+
+	name = format[:idx]
+
+	for i := idx + 1; i <= len(format); i++ {
+		if i == len(format) || format[i] == '+' || format[i] == '-' {
+			exts = append(exts, format[idx:i])
+			idx = i
+		}
+	}
+
+	return
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
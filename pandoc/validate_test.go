@@ -0,0 +1,73 @@
+package pandoc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		name   string
+		exts   []string
+	}{
+		{"markdown", "markdown", nil},
+		{"markdown+smart", "markdown", []string{"+smart"}},
+		{"markdown+smart-raw_html+emoji", "markdown", []string{"+smart", "-raw_html", "+emoji"}},
+		{"gfm-", "gfm", []string{"-"}},
+		{"html+", "html", []string{"+"}},
+		{"+smart", "", []string{"+smart"}},
+	}
+
+	for _, test := range tests {
+		name, exts := splitFormat(test.format)
+		if name != test.name || !reflect.DeepEqual(exts, test.exts) {
+			t.Fatalf("%s: unexpected %s %v", test.format, name, exts)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	caps := &Capabilities{
+		Version:       "2.5",
+		inputFormats:  toSet([]string{"markdown", "docx"}),
+		outputFormats: toSet([]string{"html", "docx"}),
+		extensions:    toSet([]string{"smart", "raw_html"}),
+	}
+
+	tests := []struct {
+		caps   *Capabilities
+		opts   ConvertOptions
+		fields []string // the invalid fields in order
+	}{
+		{caps, ConvertOptions{From: "markdown+smart-raw_html", To: "html"}, nil},
+		{caps, ConvertOptions{From: "markdown", To: "pdf"}, nil},
+		{caps, ConvertOptions{From: "markdown", To: "writer.lua"}, nil},
+		{caps, ConvertOptions{From: "rst", To: "epub"}, []string{"from", "to"}},
+		{caps, ConvertOptions{From: "markdown+bogus+", To: "html"}, []string{"from", "from"}},
+		{caps, ConvertOptions{From: "markdown", To: "html", Sandbox: true, IpynbOutput: "best"}, []string{"ipynb_output", "sandbox"}},
+		{nil, ConvertOptions{From: "rst+bogus", To: "epub", Sandbox: true}, nil},
+		{nil, ConvertOptions{Wrap: "bogus", TrackChanges: "all"}, []string{"wrap"}},
+		{nil, ConvertOptions{BaseHeaderLevel: 7, TabStop: -1, TOCDepth: 6}, []string{"base_header_level", "tab_stop"}},
+		{nil, ConvertOptions{NumberOffset: IntList{1, -1}}, []string{"number_offset"}},
+		{nil, ConvertOptions{Mathml: true, Katex: "url", Gladtex: true}, []string{"katex", "gladtex"}},
+		{nil, ConvertOptions{Natbib: true, Biblatex: true}, []string{"biblatex"}},
+	}
+
+	for i, test := range tests {
+		err := test.opts.Validate(test.caps)
+
+		var fields []string
+		if verr, ok := err.(*ValidationError); ok {
+			for _, f := range verr.Fields {
+				fields = append(fields, f.Field)
+			}
+		} else if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Fatalf("%d: the invalid fields are %v, expected: %v, error: %v", i, fields, test.fields, err)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gogap/config"
+)
+
+type principalKey struct{}
+
+// Principal is the authenticated client and its permissions,
+// the empty list means no restriction
+type Principal struct {
+	Name      string   `json:"sub"`
+	Fetchers  []string `json:"fetchers"`
+	Formats   []string `json:"formats"`
+	Templates []string `json:"templates"`
+	Filters   bool     `json:"filters"`
+}
+
+func (p *Principal) CheckArgs(args ConvertArgs) (err error) {
+
+	if args.Fetcher != nil {
+		for _, name := range args.Fetcher.Names() {
+			if !allowed(p.Fetchers, name) {
+				err = fmt.Errorf("fetcher %s is not allowed", name)
+				return
+			}
+		}
+	}
+
+	if args.Converter != nil {
+		format := baseFormat(args.Converter.To)
+
+		if !allowed(p.Formats, format) {
+			err = fmt.Errorf("output format %s is not allowed", format)
+			return
+		}
+
+		// the urls of file options are downloaded by the server, so they
+		// are allowed as the http fetcher
+		if urls := args.Converter.RemoteURLs(); len(urls) > 0 && !allowed(p.Fetchers, "http") {
+			err = fmt.Errorf("url %s is not allowed, fetcher http is required", urls[0])
+			return
+		}
+
+		if !p.Filters && (len(args.Converter.Filter) > 0 || len(args.Converter.LuaFilter) > 0) {
+			err = errors.New("filters are not allowed")
+			return
+		}
+	}
+
+	if len(args.Template) > 0 && !allowed(p.Templates, args.Template) {
+		err = fmt.Errorf("template %s is not allowed", args.Template)
+		return
+	}
+
+	return
+}
+
+func allowed(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, item := range list {
+		if item == v || item == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// baseFormat strips the extensions of format, e.g. markdown+smart
+func baseFormat(format string) string {
+	if idx := strings.IndexAny(format, "+-"); idx > 0 {
+		format = format[:idx]
+	}
+
+	return strings.ToLower(format)
+}
+
+type jwtClaims struct {
+	Principal
+
+	Exp int64 `json:"exp"`
+	Nbf int64 `json:"nbf"`
+}
+
+type authenticator struct {
+	keys      map[string]Principal
+	jwtSecret []byte
+	skipPaths map[string]bool
+}
+
+func newAuthenticator(conf config.Configuration, skipPaths ...string) (auth *authenticator, err error) {
+
+	auth = &authenticator{
+		keys:      make(map[string]Principal),
+		skipPaths: make(map[string]bool),
+	}
+
+	for _, path := range skipPaths {
+		auth.skipPaths[path] = true
+	}
+
+	keysConf := conf.GetConfig("keys")
+
+	if keysConf != nil {
+		for _, name := range keysConf.Keys() {
+			keyConf := keysConf.GetConfig(name)
+
+			key := keyConf.GetString("key")
+			if len(key) == 0 {
+				err = fmt.Errorf("the api key of %s is empty", name)
+				return
+			}
+
+			if _, exist := auth.keys[key]; exist {
+				err = fmt.Errorf("the api key of %s is duplicated", name)
+				return
+			}
+
+			auth.keys[key] = Principal{
+				Name:      name,
+				Fetchers:  keyConf.GetStringList("fetchers"),
+				Formats:   keyConf.GetStringList("formats"),
+				Templates: keyConf.GetStringList("templates"),
+				Filters:   keyConf.GetBoolean("filters", false),
+			}
+		}
+	}
+
+	auth.jwtSecret = []byte(conf.GetString("jwt.secret"))
+
+	if len(auth.keys) == 0 && len(auth.jwtSecret) == 0 {
+		err = errors.New("auth is enabled, but non api keys or jwt secret configured")
+		return
+	}
+
+	return
+}
+
+func (p *authenticator) ServeHTTP(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+
+	if p.skipPaths[req.URL.Path] || req.Method == "OPTIONS" {
+		next(rw, req)
+		return
+	}
+
+	principal, err := p.authenticate(req)
+
+	if err != nil {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="go-pandoc"`)
+		writeResp(rw, ConvertArgs{}, ConvertResponse{http.StatusUnauthorized, err.Error(), nil, nil})
+		return
+	}
+
+	next(rw, req.WithContext(context.WithValue(req.Context(), principalKey{}, principal)))
+}
+
+func (p *authenticator) authenticate(req *http.Request) (principal *Principal, err error) {
+
+	token := req.Header.Get("X-API-Key")
+
+	if len(token) == 0 {
+		authorization := req.Header.Get("Authorization")
+		if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+			token = strings.TrimSpace(authorization[7:])
+		}
+	}
+
+	if len(token) == 0 {
+		err = errors.New("api key or bearer token is required")
+		return
+	}
+
+	for key, keyPrincipal := range p.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			kp := keyPrincipal
+			principal = &kp
+			return
+		}
+	}
+
+	if len(p.jwtSecret) > 0 && strings.Count(token, ".") == 2 {
+		return p.verifyJWT(token)
+	}
+
+	err = errors.New("invalid api key")
+
+	return
+}
+
+// verifyJWT validates the HS256 signed token, the permissions are in the claims,
+// the exp is required
+func (p *authenticator) verifyJWT(token string) (principal *Principal, err error) {
+
+	parts := strings.Split(token, ".")
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+
+	err = decodeJWTPart(parts[0], &header)
+	if err != nil {
+		return
+	}
+
+	if header.Alg != "HS256" {
+		err = fmt.Errorf("jwt alg %s not support", header.Alg)
+		return
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		err = errors.New("invalid jwt signature")
+		return
+	}
+
+	mac := hmac.New(sha256.New, p.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		err = errors.New("invalid jwt signature")
+		return
+	}
+
+	claims := jwtClaims{}
+
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	// the token without exp could never be revoked
+	if claims.Exp <= 0 {
+		err = errors.New("jwt exp is required")
+		return
+	}
+
+	if now >= claims.Exp {
+		err = errors.New("jwt is expired")
+		return
+	}
+
+	if claims.Nbf > 0 && now < claims.Nbf {
+		err = errors.New("jwt is not valid yet")
+		return
+	}
+
+	principal = &claims.Principal
+
+	return
+}
+
+func decodeJWTPart(part string, v interface{}) (err error) {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		err = errors.New("invalid jwt format")
+		return
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		err = errors.New("invalid jwt format")
+		return
+	}
+
+	return
+}
+
+func principalFromRequest(req *http.Request) *Principal {
+	principal, _ := req.Context().Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// checkPermission returns nil if the auth is disabled
+func checkPermission(req *http.Request, args ConvertArgs) error {
+	principal := principalFromRequest(req)
+	if principal == nil {
+		return nil
+	}
+
+	return principal.CheckArgs(args)
+}
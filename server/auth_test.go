@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/gogap/go-pandoc/pandoc"
+	"github.com/gogap/go-pandoc/server/jobstore"
+	"github.com/gogap/go-pandoc/server/jobstore/memory"
+	"github.com/gorilla/mux"
+)
+
+func TestJobResultTemplatePermission(t *testing.T) {
+	defaultTmpl = template.Must(template.New("default").Funcs(funcMap).Parse(defaultTemplateText))
+
+	store, err := memory.NewMemoryJobStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldJobs := jobs
+	jobs = &jobManager{ctx: context.Background(), store: store, retention: time.Hour}
+	defer func() { jobs = oldJobs }()
+
+	err = store.Save(jobstore.Job{ID: "job-1", Owner: "team-a", Status: jobstore.StatusSucceeded, To: "html", Created: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal := &Principal{Name: "team-a", Templates: []string{"binary"}}
+
+	req := httptest.NewRequest("GET", "/v1/jobs/job-1/result?template=render-html", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "job-1"})
+	req = req.WithContext(context.WithValue(req.Context(), principalKey{}, principal))
+
+	rw := httptest.NewRecorder()
+
+	handleJobResult(rw, req)
+
+	resp := ConvertResponse{}
+
+	err = json.Unmarshal(rw.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err, rw.Body.String())
+	}
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("the template should be denied, got %s", rw.Body.String())
+	}
+}
+
+func TestCheckArgsRemoteURLs(t *testing.T) {
+	tests := []struct {
+		fetchers []string
+		opts     pandoc.ConvertOptions
+		allowed  bool
+	}{
+		{[]string{"data"}, pandoc.ConvertOptions{To: "html", Template: "https://example.com/tmpl.html"}, false},
+		{[]string{"data"}, pandoc.ConvertOptions{To: "html", CSS: "http://example.com/style.css"}, false},
+		{[]string{"data"}, pandoc.ConvertOptions{To: "docx", ReferenceDoc: "data:application/octet-stream;base64,AA=="}, true},
+		{[]string{"data"}, pandoc.ConvertOptions{To: "html", MetadataFile: "metadata_file/meta.yaml"}, true},
+		{[]string{"data", "http"}, pandoc.ConvertOptions{To: "html", Bibliography: "https://example.com/refs.bib"}, true},
+		{nil, pandoc.ConvertOptions{To: "html", IncludeInHeader: "https://example.com/header.html"}, true},
+	}
+
+	for i, test := range tests {
+		principal := &Principal{Name: "team-a", Fetchers: test.fetchers}
+
+		opts := test.opts
+		err := principal.CheckArgs(ConvertArgs{Converter: &opts})
+
+		if (err == nil) != test.allowed {
+			t.Fatalf("test %d, allowed: %v, error: %v", i, test.allowed, err)
+		}
+	}
+}
+
+func signJWT(secret, header, claims string) string {
+	h := base64.RawURLEncoding.EncodeToString([]byte(header))
+	c := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(h + "." + c))
+
+	return h + "." + c + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	auth := &authenticator{jwtSecret: []byte("secret")}
+
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", signJWT("secret", hs256, fmt.Sprintf(`{"sub":"team-a","formats":["pdf"],"exp":%d}`, now+60)), true},
+		{"no exp", signJWT("secret", hs256, `{"sub":"team-a"}`), false},
+		{"expired", signJWT("secret", hs256, fmt.Sprintf(`{"sub":"team-a","exp":%d}`, now-60)), false},
+		{"not valid yet", signJWT("secret", hs256, fmt.Sprintf(`{"sub":"team-a","exp":%d,"nbf":%d}`, now+120, now+60)), false},
+		{"wrong secret", signJWT("other", hs256, fmt.Sprintf(`{"sub":"team-a","exp":%d}`, now+60)), false},
+		{"alg none", signJWT("secret", `{"alg":"none"}`, fmt.Sprintf(`{"sub":"team-a","exp":%d}`, now+60)), false},
+		{"malformed claims", signJWT("secret", hs256, `{"sub":`), false},
+		{"malformed signature", signJWT("secret", hs256, fmt.Sprintf(`{"sub":"team-a","exp":%d}`, now+60)) + "!", false},
+	}
+
+	for _, test := range tests {
+		principal, err := auth.verifyJWT(test.token)
+
+		if (err == nil) != test.valid {
+			t.Fatalf("%s, valid: %v, error: %v", test.name, test.valid, err)
+		}
+
+		if test.valid && (principal.Name != "team-a" || len(principal.Formats) != 1) {
+			t.Fatalf("%s, unexpected principal: %+v", test.name, principal)
+		}
+	}
+}
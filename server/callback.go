@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc"
+	"github.com/gogap/go-pandoc/pandoc/netguard"
+)
+
+type CallbackOptions struct {
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers"`
+	Secret        string            `json:"secret"`
+	IncludeResult bool              `json:"include_result"`
+}
+
+func (p *CallbackOptions) Validation() (err error) {
+	if len(p.URL) == 0 {
+		err = fmt.Errorf("callback url is empty")
+		return
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		err = fmt.Errorf("parse callback url failure, error: %s", err)
+		return
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = fmt.Errorf("callback url schema %s not support", u.Scheme)
+		return
+	}
+
+	return
+}
+
+type CallbackData struct {
+	Job   interface{}         `json:"job"`
+	Data  []byte              `json:"data,omitempty"`
+	Files []pandoc.OutputFile `json:"files,omitempty"`
+}
+
+type callbackSender struct {
+	client *http.Client
+
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func newCallbackSender(conf config.Configuration) (sender *callbackSender, err error) {
+
+	var networkConf config.Configuration
+	if conf != nil {
+		networkConf = conf.GetConfig("network")
+	}
+
+	// the callback url is provided by client, so it is guarded as same as fetchers
+	policy, err := netguard.NewPolicy(networkConf)
+	if err != nil {
+		return
+	}
+
+	sender = &callbackSender{
+		client:     policy.NewClient(),
+		maxRetries: 5,
+		backoff:    time.Second,
+		maxBackoff: time.Minute,
+	}
+
+	sender.client.Timeout = time.Second * 10
+
+	if conf == nil {
+		return
+	}
+
+	sender.client.Timeout = conf.GetTimeDuration("timeout", sender.client.Timeout)
+	sender.maxRetries = int(conf.GetInt32("max-retries", int32(sender.maxRetries)))
+	sender.backoff = conf.GetTimeDuration("backoff", sender.backoff)
+	sender.maxBackoff = conf.GetTimeDuration("max-backoff", sender.maxBackoff)
+
+	return
+}
+
+// Send posts the response to the callback url, and retries with backoff
+// until it is done or the context is done, e.g. the server is shutting down
+func (p *callbackSender) Send(ctx context.Context, opts CallbackOptions, resp ConvertResponse) (err error) {
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	backoff := p.backoff
+
+	for i := 0; ; i++ {
+		err = p.post(ctx, opts, body)
+		if err == nil || i >= p.maxRetries || netguard.IsBlocked(err) {
+			return
+		}
+
+		log.Printf("[callback]: post to %s failure, retry after %s: %s\n", opts.URL, backoff, err)
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+			return
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+func (p *callbackSender) post(ctx context.Context, opts CallbackOptions, body []byte) (err error) {
+
+	req, err := http.NewRequest("POST", opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	req = req.WithContext(ctx)
+
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(opts.Secret) > 0 {
+		req.Header.Set("X-Signature", "sha256="+signCallback(opts.Secret, body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("status code is %d", resp.StatusCode)
+		return
+	}
+
+	return
+}
+
+func signCallback(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gogap/go-pandoc/pandoc/netguard"
+)
+
+func newTestCallbackSender(maxRetries int, backoff time.Duration) *callbackSender {
+	policy := netguard.DefaultPolicy()
+	policy.AllowPrivate = true
+
+	return &callbackSender{
+		client:     policy.NewClient(),
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		maxBackoff: backoff,
+	}
+}
+
+func TestCallbackSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int // the requests responded with 500 before success
+		maxRetries int
+		requests   int
+		success    bool
+	}{
+		{"success", 0, 3, 1, true},
+		{"retry", 2, 3, 3, true},
+		{"give up", 10, 2, 3, false},
+	}
+
+	for _, test := range tests {
+		requests := 0
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+
+			body, _ := ioutil.ReadAll(req.Body)
+
+			if req.Header.Get("X-Signature") != "sha256="+signCallback("secret", body) {
+				t.Errorf("%s, invalid signature", test.name)
+			}
+
+			if requests <= test.failures {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+
+		sender := newTestCallbackSender(test.maxRetries, time.Millisecond)
+
+		err := sender.Send(context.Background(), CallbackOptions{URL: srv.URL, Secret: "secret"}, ConvertResponse{})
+
+		srv.Close()
+
+		if (err == nil) != test.success || requests != test.requests {
+			t.Fatalf("%s, requests: %d, error: %v", test.name, requests, err)
+		}
+	}
+}
+
+func TestCallbackSendCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sender := newTestCallbackSender(3, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	begin := time.Now()
+
+	err := sender.Send(ctx, CallbackOptions{URL: srv.URL}, ConvertResponse{})
+
+	if err != context.DeadlineExceeded || time.Now().Sub(begin) > time.Second*5 {
+		t.Fatalf("the backoff should be stopped by context, error: %v", err)
+	}
+}
+
+func TestCallbackSendBlocked(t *testing.T) {
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	sender := &callbackSender{client: netguard.DefaultPolicy().NewClient(), maxRetries: 3, backoff: time.Hour, maxBackoff: time.Hour}
+
+	err := sender.Send(context.Background(), CallbackOptions{URL: srv.URL}, ConvertResponse{})
+
+	if !netguard.IsBlocked(err) || requests != 0 {
+		t.Fatalf("the loopback url should be blocked without retry, error: %v", err)
+	}
+}
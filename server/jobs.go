@@ -0,0 +1,360 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc"
+	"github.com/gogap/go-pandoc/server/jobstore"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type jobManager struct {
+	ctx context.Context
+
+	store     jobstore.JobStore
+	retention time.Duration
+	callback  *callbackSender
+}
+
+func newJobManager(ctx context.Context, jobsConf config.Configuration) (m *jobManager, err error) {
+
+	driver := "memory"
+	var storeOptions config.Configuration
+
+	if jobsConf != nil {
+		driver = jobsConf.GetString("store.driver", driver)
+		storeOptions = jobsConf.GetConfig("store.options")
+	}
+
+	store, err := jobstore.New(driver, storeOptions)
+	if err != nil {
+		return
+	}
+
+	retention := time.Hour
+	var callbackConf config.Configuration
+
+	if jobsConf != nil {
+		retention = jobsConf.GetTimeDuration("retention", retention)
+		callbackConf = jobsConf.GetConfig("callback")
+	}
+
+	callback, err := newCallbackSender(callbackConf)
+	if err != nil {
+		return
+	}
+
+	m = &jobManager{
+		ctx:       ctx,
+		store:     store,
+		retention: retention,
+		callback:  callback,
+	}
+
+	go m.cleanup()
+
+	return
+}
+
+func (p *jobManager) cleanup() {
+	interval := p.retention / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		jobs, err := p.store.List()
+		if err != nil {
+			log.Printf("[jobs]: list jobs failure: %s\n", err)
+			continue
+		}
+
+		for _, job := range jobs {
+			if !job.Expired(now) {
+				continue
+			}
+
+			err = p.store.Delete(job.ID)
+			if err != nil {
+				log.Printf("[jobs]: delete expired job %s failure: %s\n", job.ID, err)
+			}
+		}
+	}
+}
+
+func (p *jobManager) submit(args ConvertArgs, owner string) (job jobstore.Job, err error) {
+
+	now := time.Now()
+
+	job = jobstore.Job{
+		ID:       uuid.New().String(),
+		Status:   jobstore.StatusQueued,
+		From:     args.Converter.From,
+		To:       args.Converter.To,
+		Output:   args.Converter.OutputMode,
+		Template: args.Template,
+		Owner:    owner,
+		Created:  now,
+		Updated:  now,
+	}
+
+	err = p.store.Save(job)
+	if err != nil {
+		return
+	}
+
+	go p.run(job, args)
+
+	return
+}
+
+func (p *jobManager) run(job jobstore.Job, args ConvertArgs) {
+
+	// the panic of conversion fails the job only, not the server
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[jobs]: job %s panic: %v\n%s", job.ID, r, debug.Stack())
+
+			job.Code = http.StatusInternalServerError
+			job.ErrorType = errorTypeOfCode(job.Code)
+			p.update(&job, jobstore.StatusFailed, fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+
+	p.update(&job, jobstore.StatusRunning, "")
+
+	var convData []byte
+
+	begin := time.Now()
+
+	result, err := pdoc.RunContext(p.ctx, *args.Fetcher, *args.Converter)
+
+	metrics.observeConvert(args.Converter, begin, result, err)
+
+	if err == nil {
+		job.From = result.From
+		convData, err = encodeJobResult(result)
+	}
+
+	if err == nil {
+		err = p.store.SaveResult(job.ID, convData)
+	}
+
+	if err != nil {
+		job.Code = convertErrorCode(err)
+		job.ErrorType = string(pandoc.ErrorTypeOf(err))
+		p.update(&job, jobstore.StatusFailed, err.Error())
+	} else {
+		p.update(&job, jobstore.StatusSucceeded, "")
+	}
+
+	if args.Callback == nil {
+		return
+	}
+
+	resp := ConvertResponse{0, "", CallbackData{Job: job}, nil}
+
+	if err != nil {
+		resp = convertErrorResponse(err)
+		resp.Result = CallbackData{Job: job}
+	} else if args.Callback.IncludeResult {
+		resp.Result = CallbackData{Job: job, Data: result.Data, Files: result.Files}
+	}
+
+	err = p.callback.Send(p.ctx, *args.Callback, resp)
+	if err != nil {
+		log.Printf("[jobs]: callback of job %s failure: %s\n", job.ID, err)
+	}
+}
+
+func (p *jobManager) update(job *jobstore.Job, status jobstore.Status, message string) {
+
+	job.Status = status
+	job.Message = message
+	job.Updated = time.Now()
+
+	if job.Finished() {
+		job.Expires = job.Updated.Add(p.retention)
+	}
+
+	err := p.store.Save(*job)
+
+	if err != nil {
+		log.Printf("[jobs]: save job %s failure: %s\n", job.ID, err)
+	}
+}
+
+func (p *jobManager) get(req *http.Request, id string) (job jobstore.Job, err error) {
+	job, err = p.store.Get(id)
+	if err != nil {
+		return
+	}
+
+	if job.Expired(time.Now()) {
+		err = jobstore.ErrJobNotFound
+		return
+	}
+
+	// the job is only visible to the client who submitted it
+	if principal := principalFromRequest(req); principal != nil && principal.Name != job.Owner {
+		err = jobstore.ErrJobNotFound
+		return
+	}
+
+	return
+}
+
+func handleCreateJob(rw http.ResponseWriter, req *http.Request) {
+
+	args, err := decodeConvertArgs(req)
+
+	if err == nil && args.Callback != nil {
+		err = args.Callback.Validation()
+	}
+
+	// the job is rejected at once if the options are invalid
+	if err == nil {
+		err = pdoc.Validate(*args.Converter)
+	}
+
+	if err != nil {
+		writeResp(rw, args, convertErrorResponse(err))
+		return
+	}
+
+	if err = checkPermission(req, args); err != nil {
+		writeResp(rw, args, ConvertResponse{http.StatusForbidden, err.Error(), nil, nil})
+		return
+	}
+
+	if err = limiter.Allow(rw, req, args); err != nil {
+		writeResp(rw, args, ConvertResponse{rateLimitErrorCode(rw, err), err.Error(), nil, nil})
+		return
+	}
+
+	owner := ""
+	if principal := principalFromRequest(req); principal != nil {
+		owner = principal.Name
+	}
+
+	job, err := jobs.submit(args, owner)
+
+	if err != nil {
+		writeResp(rw, ConvertArgs{}, ConvertResponse{http.StatusInternalServerError, err.Error(), nil, nil})
+		return
+	}
+
+	writeResp(rw, ConvertArgs{}, ConvertResponse{0, "", job, nil})
+}
+
+func handleJobStatus(rw http.ResponseWriter, req *http.Request) {
+
+	job, err := jobs.get(req, mux.Vars(req)["id"])
+
+	if err != nil {
+		writeResp(rw, ConvertArgs{}, ConvertResponse{jobErrorCode(err), err.Error(), nil, nil})
+		return
+	}
+
+	writeResp(rw, ConvertArgs{}, ConvertResponse{0, "", job, nil})
+}
+
+func handleJobResult(rw http.ResponseWriter, req *http.Request) {
+
+	job, err := jobs.get(req, mux.Vars(req)["id"])
+
+	if err != nil {
+		writeResp(rw, ConvertArgs{}, ConvertResponse{jobErrorCode(err), err.Error(), nil, nil})
+		return
+	}
+
+	args := ConvertArgs{
+		Converter: &pandoc.ConvertOptions{From: job.From, To: job.To, OutputMode: job.Output},
+		Template:  job.Template,
+	}
+
+	if tmpl := req.URL.Query().Get("template"); len(tmpl) > 0 {
+		args.Template = tmpl
+	}
+
+	if err = checkPermission(req, args); err != nil {
+		writeResp(rw, ConvertArgs{}, ConvertResponse{http.StatusForbidden, err.Error(), nil, nil})
+		return
+	}
+
+	switch job.Status {
+	case jobstore.StatusFailed:
+		// the jobs failed before the code is stored
+		if job.Code == 0 {
+			job.Code, job.ErrorType = http.StatusBadRequest, string(pandoc.ErrorTypeInvalid)
+		}
+
+		writeResp(rw, args, ConvertResponse{job.Code, job.Message, nil, &ErrorInfo{Type: job.ErrorType}})
+		return
+	case jobstore.StatusQueued, jobstore.StatusRunning:
+		writeResp(rw, args, ConvertResponse{http.StatusConflict, "job is " + string(job.Status), nil, nil})
+		return
+	}
+
+	convData, err := jobs.store.GetResult(job.ID)
+
+	if err != nil {
+		writeResp(rw, args, ConvertResponse{jobErrorCode(err), err.Error(), nil, nil})
+		return
+	}
+
+	data, err := decodeJobResult(job, convData)
+
+	if err != nil {
+		writeResp(rw, args, ConvertResponse{http.StatusInternalServerError, err.Error(), nil, nil})
+		return
+	}
+
+	writeResp(rw, args, ConvertResponse{0, "", data, nil})
+}
+
+// encodeJobResult keeps the files of manifest output mode in json
+func encodeJobResult(result *pandoc.Result) (data []byte, err error) {
+	if result.Files == nil {
+		data = result.Data
+		return
+	}
+
+	return json.Marshal(result.Files)
+}
+
+func decodeJobResult(job jobstore.Job, data []byte) (convData ConvertData, err error) {
+	convData.From = job.From
+
+	if job.Output != pandoc.OutputModeManifest {
+		convData.Data = data
+		return
+	}
+
+	err = json.Unmarshal(data, &convData.Files)
+
+	return
+}
+
+func jobErrorCode(err error) int {
+	if err == jobstore.ErrJobNotFound || err == jobstore.ErrResultNotFound {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
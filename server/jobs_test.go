@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gogap/go-pandoc/pandoc"
+	"github.com/gogap/go-pandoc/server/jobstore"
+	"github.com/gogap/go-pandoc/server/jobstore/memory"
+)
+
+func TestJobRunRecover(t *testing.T) {
+	store, err := memory.NewMemoryJobStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &jobManager{ctx: context.Background(), store: store, retention: time.Hour}
+
+	job := jobstore.Job{ID: "job-1", Status: jobstore.StatusQueued}
+
+	err = store.Save(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the conversion panics with nil pandoc
+	oldPdoc := pdoc
+	pdoc = nil
+	defer func() { pdoc = oldPdoc }()
+
+	m.run(job, ConvertArgs{Fetcher: &pandoc.FetcherOptions{}, Converter: &pandoc.ConvertOptions{}})
+
+	job, err = store.Get("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != jobstore.StatusFailed || job.Code != http.StatusInternalServerError || job.ErrorType != "internal" {
+		t.Fatalf("the job should be failed, got %+v", job)
+	}
+}
@@ -0,0 +1,188 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/server/jobstore"
+)
+
+const (
+	jobFileExt    = ".json"
+	resultFileExt = ".result"
+)
+
+type DiskJobStore struct {
+	dir string
+
+	locker sync.RWMutex
+}
+
+func init() {
+	err := jobstore.RegisterJobStore("disk", NewDiskJobStore)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewDiskJobStore(conf config.Configuration) (store jobstore.JobStore, err error) {
+
+	dir := filepath.Join(os.TempDir(), "go-pandoc-jobs")
+
+	if conf != nil {
+		dir = conf.GetString("dir", dir)
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		err = fmt.Errorf("[jobstore-disk]: make job dir failure: %s, error: %s", dir, err)
+		return
+	}
+
+	store = &DiskJobStore{
+		dir: dir,
+	}
+
+	return
+}
+
+func (p *DiskJobStore) filename(id, ext string) (fname string, err error) {
+	if len(id) == 0 || strings.ContainsAny(id, `/\.`) {
+		err = fmt.Errorf("[jobstore-disk]: invalid job id: %s", id)
+		return
+	}
+
+	fname = filepath.Join(p.dir, id+ext)
+
+	return
+}
+
+func (p *DiskJobStore) Save(job jobstore.Job) (err error) {
+	fname, err := p.filename(job.ID, jobFileExt)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	err = ioutil.WriteFile(fname, data, 0644)
+
+	return
+}
+
+func (p *DiskJobStore) Get(id string) (job jobstore.Job, err error) {
+	fname, err := p.filename(id, jobFileExt)
+	if err != nil {
+		return
+	}
+
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	return p.readJob(fname)
+}
+
+func (p *DiskJobStore) readJob(fname string) (job jobstore.Job, err error) {
+	data, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		err = jobstore.ErrJobNotFound
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &job)
+
+	return
+}
+
+func (p *DiskJobStore) List() (jobs []jobstore.Job, err error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	files, err := filepath.Glob(filepath.Join(p.dir, "*"+jobFileExt))
+	if err != nil {
+		return
+	}
+
+	for _, fname := range files {
+		job, e := p.readJob(fname)
+		if e != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	return
+}
+
+func (p *DiskJobStore) SaveResult(id string, data []byte) (err error) {
+	fname, err := p.filename(id, resultFileExt)
+	if err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	err = ioutil.WriteFile(fname, data, 0644)
+
+	return
+}
+
+func (p *DiskJobStore) GetResult(id string) (data []byte, err error) {
+	fname, err := p.filename(id, resultFileExt)
+	if err != nil {
+		return
+	}
+
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	data, err = ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		err = jobstore.ErrResultNotFound
+		return
+	}
+
+	return
+}
+
+func (p *DiskJobStore) Delete(id string) (err error) {
+	jobFile, err := p.filename(id, jobFileExt)
+	if err != nil {
+		return
+	}
+
+	resultFile, err := p.filename(id, resultFileExt)
+	if err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	os.Remove(resultFile)
+
+	err = os.Remove(jobFile)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
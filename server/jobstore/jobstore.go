@@ -0,0 +1,97 @@
+package jobstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gogap/config"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrResultNotFound = errors.New("job result not found")
+)
+
+type Job struct {
+	ID        string    `json:"id"`
+	Status    Status    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	Code      int       `json:"code,omitempty"`       // the status code if failed
+	ErrorType string    `json:"error_type,omitempty"` // the error type if failed
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Output    string    `json:"output,omitempty"`
+	Template  string    `json:"template,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Expires   time.Time `json:"expires,omitempty"`
+}
+
+func (p *Job) Finished() bool {
+	return p.Status == StatusSucceeded || p.Status == StatusFailed
+}
+
+func (p *Job) Expired(now time.Time) bool {
+	return p.Finished() && !p.Expires.IsZero() && now.After(p.Expires)
+}
+
+// JobStore keeps the state and the result of async conversion jobs
+type JobStore interface {
+	Save(job Job) error
+	Get(id string) (Job, error)
+	List() ([]Job, error)
+	SaveResult(id string, data []byte) error
+	GetResult(id string) ([]byte, error)
+	Delete(id string) error
+}
+
+type NewJobStoreFunc func(config.Configuration) (JobStore, error)
+
+var (
+	newJobStoreFuncs = make(map[string]NewJobStoreFunc)
+)
+
+func New(name string, conf config.Configuration) (s JobStore, err error) {
+	fn, exist := newJobStoreFuncs[name]
+	if !exist {
+		err = fmt.Errorf("job store driver of %s not exist", name)
+		return
+	}
+
+	return fn(conf)
+}
+
+func RegisterJobStore(name string, fn NewJobStoreFunc) (err error) {
+
+	if len(name) == 0 {
+		err = fmt.Errorf("job store driver name is empty")
+		return
+	}
+
+	if fn == nil {
+		err = fmt.Errorf("the job store driver of %s's new func is nil", name)
+		return
+	}
+
+	_, exist := newJobStoreFuncs[name]
+
+	if exist {
+		err = fmt.Errorf("driver of %s already exist", name)
+		return
+	}
+
+	newJobStoreFuncs[name] = fn
+
+	return
+}
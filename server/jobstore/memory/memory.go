@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/server/jobstore"
+)
+
+type MemoryJobStore struct {
+	jobs    map[string]jobstore.Job
+	results map[string][]byte
+
+	locker sync.RWMutex
+}
+
+func init() {
+	err := jobstore.RegisterJobStore("memory", NewMemoryJobStore)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewMemoryJobStore(conf config.Configuration) (store jobstore.JobStore, err error) {
+	store = &MemoryJobStore{
+		jobs:    make(map[string]jobstore.Job),
+		results: make(map[string][]byte),
+	}
+	return
+}
+
+func (p *MemoryJobStore) Save(job jobstore.Job) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.jobs[job.ID] = job
+
+	return
+}
+
+func (p *MemoryJobStore) Get(id string) (job jobstore.Job, err error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	job, exist := p.jobs[id]
+	if !exist {
+		err = jobstore.ErrJobNotFound
+		return
+	}
+
+	return
+}
+
+func (p *MemoryJobStore) List() (jobs []jobstore.Job, err error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	for _, job := range p.jobs {
+		jobs = append(jobs, job)
+	}
+
+	return
+}
+
+func (p *MemoryJobStore) SaveResult(id string, data []byte) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if _, exist := p.jobs[id]; !exist {
+		err = jobstore.ErrJobNotFound
+		return
+	}
+
+	p.results[id] = data
+
+	return
+}
+
+func (p *MemoryJobStore) GetResult(id string) (data []byte, err error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	data, exist := p.results[id]
+	if !exist {
+		err = jobstore.ErrResultNotFound
+		return
+	}
+
+	return
+}
+
+func (p *MemoryJobStore) Delete(id string) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	delete(p.jobs, id)
+	delete(p.results, id)
+
+	return
+}
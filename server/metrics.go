@@ -0,0 +1,277 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogap/go-pandoc/pandoc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/urfave/negroni"
+)
+
+const metricsNamespace = "go_pandoc"
+
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	conversions        *prometheus.CounterVec
+	conversionDuration *prometheus.HistogramVec
+	processDuration    *prometheus.HistogramVec
+
+	fetchDuration *prometheus.HistogramVec
+	fetchErrors   *prometheus.CounterVec
+
+	inputBytes  prometheus.Counter
+	outputBytes prometheus.Counter
+
+	cacheRequests *prometheus.CounterVec
+}
+
+func newServerMetrics(servers func() []*serverWrapper) *serverMetrics {
+
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of http requests by method and status code.",
+		}, []string{"method", "code"}),
+
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of http requests.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+		}, []string{"method"}),
+
+		conversions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "conversions_total",
+			Help:      "Number of conversions by format and outcome.",
+		}, []string{"from", "to", "outcome"}),
+
+		conversionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "conversion_duration_seconds",
+			Help:      "Duration of conversions including fetching and queueing.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+		}, []string{"from", "to"}),
+
+		processDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "process_duration_seconds",
+			Help:      "Duration of pandoc processes.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+		}, []string{"outcome"}),
+
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "Duration of fetching by fetcher name.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"fetcher"}),
+
+		fetchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "fetch_errors_total",
+			Help:      "Number of fetching errors by fetcher name.",
+		}, []string{"fetcher"}),
+
+		inputBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "input_bytes_total",
+			Help:      "Bytes of the fetched or uploaded inputs.",
+		}),
+
+		outputBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "output_bytes_total",
+			Help:      "Bytes of the conversion outputs.",
+		}),
+
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_requests_total",
+			Help:      "Number of result cache lookups by result, hit or miss.",
+		}, []string{"result"}),
+	}
+
+	activeRequests := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_requests",
+		Help:      "Number of http requests in processing.",
+	}, func() float64 {
+		var num int64
+		for _, srv := range servers() {
+			num += atomic.LoadInt64(&srv.reqNumber)
+		}
+		return float64(num)
+	})
+
+	queueDepth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_depth",
+		Help:      "Number of conversions waiting for a pandoc process slot.",
+	}, func() float64 {
+		return float64(pdoc.Stats().Queued)
+	})
+
+	runningProcesses := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "running_processes",
+		Help:      "Number of running pandoc processes.",
+	}, func() float64 {
+		return float64(pdoc.Stats().Running)
+	})
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.conversions,
+		m.conversionDuration,
+		m.processDuration,
+		m.fetchDuration,
+		m.fetchErrors,
+		m.inputBytes,
+		m.outputBytes,
+		m.cacheRequests,
+		activeRequests,
+		queueDepth,
+		runningProcesses,
+	)
+
+	return m
+}
+
+func (p *serverMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+// ServeHTTP is the negroni middleware to observe the http requests
+func (p *serverMetrics) ServeHTTP(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	begin := time.Now()
+
+	next(rw, req)
+
+	code := 0
+	if nrw, ok := rw.(negroni.ResponseWriter); ok {
+		code = nrw.Status()
+	}
+
+	p.httpRequests.WithLabelValues(req.Method, strconv.Itoa(code)).Inc()
+	p.httpDuration.WithLabelValues(req.Method).Observe(time.Now().Sub(begin).Seconds())
+}
+
+func (p *serverMetrics) ObserveFetch(fetcher string, size int, duration time.Duration, err error) {
+	p.fetchDuration.WithLabelValues(fetcher).Observe(duration.Seconds())
+
+	if err != nil {
+		p.fetchErrors.WithLabelValues(fetcher).Inc()
+		return
+	}
+
+	if size > 0 {
+		p.inputBytes.Add(float64(size))
+	}
+}
+
+func (p *serverMetrics) ObserveExec(duration time.Duration, err error) {
+	p.processDuration.WithLabelValues(outcome(err)).Observe(duration.Seconds())
+}
+
+func (p *serverMetrics) observeConvert(opts *pandoc.ConvertOptions, begin time.Time, result *pandoc.Result, err error) {
+
+	if p == nil || opts == nil {
+		return
+	}
+
+	from, to := formatLabels(pdoc.Capabilities(), opts)
+
+	p.conversions.WithLabelValues(from, to, outcome(err)).Inc()
+	p.conversionDuration.WithLabelValues(from, to).Observe(time.Now().Sub(begin).Seconds())
+
+	if err != nil {
+		return
+	}
+
+	size := len(result.Data)
+	for _, f := range result.Files {
+		size += f.Size
+	}
+
+	p.outputBytes.Add(float64(size))
+
+	if pdoc.CacheEnabled() {
+		if result.Cached {
+			p.cacheRequests.WithLabelValues("hit").Inc()
+		} else {
+			p.cacheRequests.WithLabelValues("miss").Inc()
+		}
+	}
+}
+
+// formatLabels returns the formats as the labels only if they are validated
+// by the capabilities of pandoc, so the labels are bounded whatever the
+// clients send, otherwise unknown if pandoc is not probed, or invalid
+func formatLabels(caps *pandoc.Capabilities, opts *pandoc.ConvertOptions) (from, to string) {
+	if caps == nil {
+		return "unknown", "unknown"
+	}
+
+	if opts.Validate(caps) != nil {
+		return "invalid", "invalid"
+	}
+
+	from = formatLabel(opts.From, caps.InputFormats)
+	to = formatLabel(opts.To, caps.OutputFormats)
+
+	// pdf is produced by the pdf engine, so it is not in the output formats
+	if baseFormat(opts.To) == "pdf" {
+		to = "pdf"
+	}
+
+	return
+}
+
+// formatLabel is empty if the format is detected, and invalid if the format
+// is not in the formats, e.g. the custom lua writers
+func formatLabel(format string, formats []string) string {
+	if len(format) == 0 {
+		return ""
+	}
+
+	name := baseFormat(format)
+
+	for _, f := range formats {
+		if f == name {
+			return name
+		}
+	}
+
+	return "invalid"
+}
+
+func (p *serverMetrics) observeUpload(size int) {
+	if p == nil {
+		return
+	}
+
+	p.inputBytes.Add(float64(size))
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
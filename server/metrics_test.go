@@ -0,0 +1,37 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gogap/go-pandoc/pandoc"
+)
+
+func TestFormatLabels(t *testing.T) {
+	caps := &pandoc.Capabilities{
+		Version:       "3.1.9",
+		InputFormats:  []string{"markdown", "docx"},
+		OutputFormats: []string{"html", "docx"},
+	}
+
+	tests := []struct {
+		caps     *pandoc.Capabilities
+		opts     pandoc.ConvertOptions
+		from, to string
+	}{
+		{caps, pandoc.ConvertOptions{From: "markdown+smart", To: "html"}, "markdown", "html"},
+		{caps, pandoc.ConvertOptions{To: "pdf"}, "", "pdf"},
+		{caps, pandoc.ConvertOptions{From: "docx", To: "writer.lua"}, "docx", "invalid"},
+		{caps, pandoc.ConvertOptions{From: "markdown", To: "html", Wrap: "bogus"}, "invalid", "invalid"},
+		{caps, pandoc.ConvertOptions{From: "markdown", To: "Random-Client-Value"}, "markdown", "invalid"},
+		{nil, pandoc.ConvertOptions{From: "markdown", To: "html"}, "unknown", "unknown"},
+	}
+
+	for i, test := range tests {
+		opts := test.opts
+		from, to := formatLabels(test.caps, &opts)
+
+		if from != test.from || to != test.to {
+			t.Fatalf("test %d, labels are %s, %s, expected %s, %s", i, from, to, test.from, test.to)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gogap/go-pandoc/pandoc"
+)
+
+const (
+	multipartSourceField    = "file"
+	multipartConverterField = "converter"
+	multipartTemplateField  = "template"
+)
+
+// the file parts could be used as the file options of the converter,
+// the other file parts are attachments, saved by the field name
+var multipartFileOptions = map[string]bool{
+	"template":               true,
+	"reference_doc":          true,
+	"bibliography":           true,
+	"csl":                    true,
+	"citation_abbreviations": true,
+	"syntax_definition":      true,
+	"include_in_header":      true,
+	"include_before_body":    true,
+	"include_after_body":     true,
+	"metadata_file":          true,
+	"epub_cover_image":       true,
+	"epub_metadata":          true,
+	"epub_embed_font":        true,
+	"abbreviations":          true,
+}
+
+type multipartArgs struct {
+	ConvertArgs
+
+	Data        []byte
+	Attachments []pandoc.Attachment
+}
+
+func isMultipart(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "multipart/form-data"
+}
+
+func decodeMultipartArgs(req *http.Request) (args multipartArgs, err error) {
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return
+	}
+
+	converter := map[string]interface{}{}
+	converterJSON := []byte(nil)
+	hasSource := false
+	sourceFilename := ""
+
+	for {
+		part, e := reader.NextPart()
+		if e == io.EOF {
+			break
+		}
+
+		if e != nil {
+			err = e
+			return
+		}
+
+		name := part.FormName()
+
+		var data []byte
+		data, err = ioutil.ReadAll(part)
+		part.Close()
+
+		if err != nil {
+			return
+		}
+
+		if len(part.FileName()) == 0 {
+			switch name {
+			case multipartConverterField:
+				converterJSON = data
+			case multipartTemplateField:
+				args.Template = string(data)
+			default:
+				converter[name] = formValue(data)
+			}
+			continue
+		}
+
+		switch {
+		case name == multipartSourceField:
+			args.Data = data
+			hasSource = true
+			sourceFilename = part.FileName()
+		case multipartFileOptions[name]:
+			attachmentName := path.Join(name, path.Base(part.FileName()))
+			converter[name] = attachmentName
+			args.Attachments = append(args.Attachments, pandoc.Attachment{Name: attachmentName, Data: data})
+		default:
+			args.Attachments = append(args.Attachments, pandoc.Attachment{Name: name, Data: data})
+		}
+	}
+
+	if !hasSource {
+		err = fmt.Errorf("multipart part of %s is not exist", multipartSourceField)
+		return
+	}
+
+	convertOpts := &pandoc.ConvertOptions{}
+
+	if len(converterJSON) > 0 {
+		err = json.Unmarshal(converterJSON, convertOpts)
+		if err != nil {
+			err = fmt.Errorf("parse converter failure, error is %s", err.Error())
+			return
+		}
+	}
+
+	if len(converter) > 0 {
+		var fields []byte
+		fields, err = json.Marshal(converter)
+		if err != nil {
+			return
+		}
+
+		err = json.Unmarshal(fields, convertOpts)
+		if err != nil {
+			err = fmt.Errorf("parse converter fields failure, error is %s", err.Error())
+			return
+		}
+	}
+
+	err = pdoc.ApplyPreset(convertOpts)
+	if err != nil {
+		return
+	}
+
+	// the format is detected by the content if the extension is unknown
+	if len(convertOpts.From) == 0 {
+		convertOpts.From = pandoc.FormatByFilename(sourceFilename)
+	}
+
+	args.Converter = convertOpts
+
+	return
+}
+
+// formValue keeps the json literal as is, e.g. true or 2,
+// so they could be unmarshaled to the bool and int options
+func formValue(data []byte) interface{} {
+	var v interface{}
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return string(data)
+	}
+
+	switch v.(type) {
+	case bool, float64:
+		return v
+	}
+
+	return string(data)
+}
+
+func handleMultipartToX(rw http.ResponseWriter, req *http.Request) {
+
+	args, err := decodeMultipartArgs(req)
+
+	if err != nil {
+		writeResp(rw, args.ConvertArgs, convertErrorResponse(err))
+		return
+	}
+
+	if err = checkPermission(req, args.ConvertArgs); err != nil {
+		writeResp(rw, args.ConvertArgs, ConvertResponse{http.StatusForbidden, err.Error(), nil, nil})
+		return
+	}
+
+	if err = limiter.Allow(rw, req, args.ConvertArgs); err != nil {
+		writeResp(rw, args.ConvertArgs, ConvertResponse{rateLimitErrorCode(rw, err), err.Error(), nil, nil})
+		return
+	}
+
+	metrics.observeUpload(len(args.Data))
+
+	begin := time.Now()
+
+	result, err := pdoc.RunDataContext(req.Context(), args.Data, *args.Converter, args.Attachments...)
+
+	metrics.observeConvert(args.Converter, begin, result, err)
+
+	if err != nil {
+		writeResp(rw, args.ConvertArgs, convertErrorResponse(err))
+		return
+	}
+
+	writeConvertResult(rw, args.ConvertArgs, result)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestDecodeMultipartFileOptions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+
+	files := []struct {
+		field, filename, data string
+	}{
+		{"file", "report.md", "# report"},
+		{"metadata_file", "meta.yaml", "title: report"},
+		{"template", "tmpl.html", "$body$"},
+		{"reference_doc", "ref.docx", "ref"},
+		{"images/logo.png", "logo.png", "png"},
+	}
+
+	for _, f := range files {
+		fw, err := w.CreateFormFile(f.field, f.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(f.data))
+	}
+
+	w.WriteField("to", "docx")
+	w.Close()
+
+	req, _ := http.NewRequest("POST", "/convert", buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	args, err := decodeMultipartArgs(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := args.Converter
+
+	if string(args.Data) != "# report" || c.From != "markdown" || c.To != "docx" {
+		t.Fatalf("unexpected source: %q %+v", args.Data, c)
+	}
+
+	if c.MetadataFile != "metadata_file/meta.yaml" || c.Template != "template/tmpl.html" || c.ReferenceDoc != "reference_doc/ref.docx" {
+		t.Fatalf("the file options should be the attachment names: %+v", c)
+	}
+
+	attachments := map[string]string{}
+	for _, a := range args.Attachments {
+		attachments[a.Name] = string(a.Data)
+	}
+
+	expected := map[string]string{
+		"metadata_file/meta.yaml": "title: report",
+		"template/tmpl.html":      "$body$",
+		"reference_doc/ref.docx":  "ref",
+		"images/logo.png":         "png",
+	}
+
+	if len(attachments) != len(expected) {
+		t.Fatalf("unexpected attachments: %v", attachments)
+	}
+
+	for name, data := range expected {
+		if attachments[name] != data {
+			t.Fatalf("attachment %s is %q, expected %q", name, attachments[name], data)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/server/ratelimit"
+)
+
+type rateLimit struct {
+	perMinute  int64
+	dailyQuota int64
+}
+
+type rateLimiter struct {
+	store ratelimit.Store
+
+	defaultLimit rateLimit
+	keyLimits    map[string]rateLimit
+	weights      map[string]int64
+
+	trustForwardedFor bool
+}
+
+type rateLimitError struct {
+	message    string
+	retryAfter time.Duration
+}
+
+func (p *rateLimitError) Error() string {
+	return p.message
+}
+
+func newRateLimiter(conf config.Configuration) (limiter *rateLimiter, err error) {
+
+	store, err := ratelimit.New(
+		conf.GetString("store.driver", "memory"),
+		conf.GetConfig("store.options"),
+	)
+
+	if err != nil {
+		return
+	}
+
+	limiter = &rateLimiter{
+		store: store,
+		defaultLimit: rateLimit{
+			perMinute:  conf.GetInt64("per-minute", 60),
+			dailyQuota: conf.GetInt64("daily-quota", 0),
+		},
+		keyLimits:         make(map[string]rateLimit),
+		weights:           make(map[string]int64),
+		trustForwardedFor: conf.GetBoolean("trust-forwarded-for", false),
+	}
+
+	if weightsConf := conf.GetConfig("weights"); weightsConf != nil {
+		for _, format := range weightsConf.Keys() {
+			limiter.weights[strings.ToLower(format)] = weightsConf.GetInt64(format, 1)
+		}
+	}
+
+	if keysConf := conf.GetConfig("keys"); keysConf != nil {
+		for _, name := range keysConf.Keys() {
+			limiter.keyLimits[name] = rateLimit{
+				perMinute:  keysConf.GetInt64(name+".per-minute", limiter.defaultLimit.perMinute),
+				dailyQuota: keysConf.GetInt64(name+".daily-quota", limiter.defaultLimit.dailyQuota),
+			}
+		}
+	}
+
+	err = limiter.checkWeights()
+	if err != nil {
+		limiter = nil
+		return
+	}
+
+	return
+}
+
+// checkWeights checks the weights are not more than the per minute limits,
+// otherwise the conversions of the format never get enough tokens
+func (p *rateLimiter) checkWeights() (err error) {
+
+	limits := map[string]rateLimit{"default": p.defaultLimit}
+	for name, limit := range p.keyLimits {
+		limits["key "+name] = limit
+	}
+
+	for format, weight := range p.weights {
+		for name, limit := range limits {
+			if limit.perMinute > 0 && weight > limit.perMinute {
+				err = fmt.Errorf("the weight %d of %s is more than the per-minute %d of %s", weight, format, limit.perMinute, name)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// client returns the api key name if authenticated, otherwise the client ip
+func (p *rateLimiter) client(req *http.Request) (client string, limit rateLimit) {
+
+	limit = p.defaultLimit
+
+	if principal := principalFromRequest(req); principal != nil {
+		if keyLimit, exist := p.keyLimits[principal.Name]; exist {
+			limit = keyLimit
+		}
+		client = "key:" + principal.Name
+		return
+	}
+
+	ip := req.RemoteAddr
+
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	if p.trustForwardedFor {
+		if forwarded := req.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+			ip = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	client = "ip:" + ip
+
+	return
+}
+
+func (p *rateLimiter) weight(args ConvertArgs) int64 {
+	if args.Converter == nil {
+		return 1
+	}
+
+	if w, exist := p.weights[baseFormat(args.Converter.To)]; exist && w > 0 {
+		return w
+	}
+
+	return 1
+}
+
+// Allow takes the weight of the conversion from the daily quota and the per
+// minute bucket of the client, and sets the X-RateLimit-* headers, the quota
+// is checked first and given back if the bucket is empty, so the rejected
+// conversions use neither of them
+func (p *rateLimiter) Allow(rw http.ResponseWriter, req *http.Request, args ConvertArgs) (err error) {
+
+	if p == nil {
+		return
+	}
+
+	client, limit := p.client(req)
+	weight := p.weight(args)
+
+	now := time.Now().UTC()
+	quotaKey := "quota:" + client + ":" + now.Format("2006-01-02")
+	reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	if limit.dailyQuota > 0 {
+
+		count, ok, e := p.store.AddCount(quotaKey, weight, limit.dailyQuota, reset)
+		if e != nil {
+			err = e
+			return
+		}
+
+		rw.Header().Set("X-RateLimit-Quota-Limit", strconv.FormatInt(limit.dailyQuota, 10))
+		rw.Header().Set("X-RateLimit-Quota-Remaining", strconv.FormatInt(limit.dailyQuota-count, 10))
+		rw.Header().Set("X-RateLimit-Quota-Reset", strconv.FormatInt(int64(reset.Sub(now)/time.Second), 10))
+
+		if !ok {
+			err = &rateLimitError{fmt.Sprintf("daily quota %d exceeded", limit.dailyQuota), reset.Sub(now)}
+			return
+		}
+	}
+
+	if limit.perMinute > 0 {
+
+		interval := time.Minute / time.Duration(limit.perMinute)
+
+		remaining, ok, e := p.store.TakeTokens("rate:"+client, weight, limit.perMinute, interval)
+
+		if (e != nil || !ok) && limit.dailyQuota > 0 {
+			// no limit when giving back, so it always succeeds
+			if count, _, e := p.store.AddCount(quotaKey, -weight, 0, reset); e == nil {
+				rw.Header().Set("X-RateLimit-Quota-Remaining", strconv.FormatInt(limit.dailyQuota-count, 10))
+			}
+		}
+
+		if e != nil {
+			err = e
+			return
+		}
+
+		rw.Header().Set("X-RateLimit-Limit", strconv.FormatInt(limit.perMinute, 10))
+		rw.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+
+		if !ok {
+			retryAfter := time.Duration(weight-remaining) * interval
+			rw.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(retryAfter/time.Second)+1, 10))
+			err = &rateLimitError{"rate limit exceeded", retryAfter}
+			return
+		}
+	}
+
+	return
+}
+
+func rateLimitErrorCode(rw http.ResponseWriter, err error) int {
+	if e, ok := err.(*rateLimitError); ok {
+		rw.Header().Set("Retry-After", strconv.FormatInt(int64(e.retryAfter/time.Second)+1, 10))
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusInternalServerError
+}
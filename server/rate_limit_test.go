@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc"
+
+	_ "github.com/gogap/go-pandoc/server/ratelimit/memory"
+)
+
+func TestNewRateLimiterWeights(t *testing.T) {
+	tests := []struct {
+		conf  string
+		valid bool
+	}{
+		{`per-minute = 10, weights { pdf = 10 }`, true},
+		{`per-minute = 10, weights { pdf = 11 }`, false},
+		{`per-minute = 0, weights { pdf = 11 }`, true},
+		{`per-minute = 20, weights { pdf = 11 }, keys { team-a { per-minute = 10 } }`, false},
+		{`per-minute = 10, weights { pdf = 11 }, keys { team-a { per-minute = 20 } }`, false},
+	}
+
+	for _, test := range tests {
+		_, err := newRateLimiter(config.NewConfig(config.ConfigString(test.conf)))
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: unexpected error: %v", test.conf, err)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter, err := newRateLimiter(config.NewConfig(config.ConfigString(
+		`per-minute = 5, daily-quota = 4, weights { pdf = 3 }`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := ConvertArgs{Converter: &pandoc.ConvertOptions{To: "pdf"}}
+	html := ConvertArgs{Converter: &pandoc.ConvertOptions{To: "html"}}
+
+	tests := []struct {
+		args           ConvertArgs
+		allowed        bool
+		quotaRemaining string
+	}{
+		{pdf, true, "1"},
+		// the bucket has 2 tokens, so the quota is given back
+		{pdf, false, "1"},
+		{html, true, "0"},
+		// the quota is exceeded before taking the tokens
+		{html, false, "0"},
+	}
+
+	for i, test := range tests {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/convert", nil)
+
+		err := limiter.Allow(rw, req, test.args)
+		if (err == nil) != test.allowed {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+
+		if remaining := rw.Header().Get("X-RateLimit-Quota-Remaining"); remaining != test.quotaRemaining {
+			t.Fatalf("%d: the remaining quota is %s, expected: %s", i, remaining, test.quotaRemaining)
+		}
+	}
+
+	// the tokens are only taken by the allowed pdf and html
+	remaining, _, err := limiter.store.TakeTokens("rate:ip:192.0.2.1", 0, 5, time.Minute/5)
+	if err != nil || remaining != 1 {
+		t.Fatalf("the remaining tokens is %d, error: %v", remaining, err)
+	}
+}
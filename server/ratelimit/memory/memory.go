@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/server/ratelimit"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens   int64
+	last     time.Time
+	interval time.Duration
+	capacity int64
+}
+
+type counter struct {
+	count  int64
+	expire time.Time
+}
+
+type MemoryStore struct {
+	buckets   map[string]*bucket
+	counters  map[string]*counter
+	lastSweep time.Time
+
+	locker sync.Mutex
+}
+
+func init() {
+	err := ratelimit.RegisterStore("memory", NewMemoryStore)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewMemoryStore(conf config.Configuration) (store ratelimit.Store, err error) {
+	store = &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		counters:  make(map[string]*counter),
+		lastSweep: time.Now(),
+	}
+	return
+}
+
+func (p *MemoryStore) TakeTokens(key string, n, capacity int64, interval time.Duration) (remaining int64, ok bool, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := time.Now()
+
+	p.sweep(now)
+
+	b, exist := p.buckets[key]
+	if !exist {
+		b = &bucket{tokens: capacity, last: now}
+		p.buckets[key] = b
+	}
+
+	b.capacity = capacity
+	b.interval = interval
+
+	if interval > 0 {
+		refill := int64(now.Sub(b.last) / interval)
+		b.tokens += refill
+		b.last = b.last.Add(time.Duration(refill) * interval)
+	}
+
+	if b.tokens >= capacity {
+		b.tokens = capacity
+		b.last = now
+	}
+
+	if b.tokens < n {
+		remaining = b.tokens
+		return
+	}
+
+	b.tokens -= n
+	remaining = b.tokens
+	ok = true
+
+	return
+}
+
+func (p *MemoryStore) AddCount(key string, n, max int64, expire time.Time) (count int64, ok bool, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := time.Now()
+
+	p.sweep(now)
+
+	c, exist := p.counters[key]
+	if !exist || now.After(c.expire) {
+		c = &counter{expire: expire}
+		p.counters[key] = c
+	}
+
+	if max > 0 && c.count+n > max {
+		count = c.count
+		return
+	}
+
+	c.count += n
+	count = c.count
+	ok = true
+
+	return
+}
+
+// sweep removes the expired counters and the full buckets
+func (p *MemoryStore) sweep(now time.Time) {
+	if now.Sub(p.lastSweep) < sweepInterval {
+		return
+	}
+
+	p.lastSweep = now
+
+	for key, c := range p.counters {
+		if now.After(c.expire) {
+			delete(p.counters, key)
+		}
+	}
+
+	for key, b := range p.buckets {
+		if b.interval > 0 && b.tokens+int64(now.Sub(b.last)/b.interval) >= b.capacity {
+			delete(p.buckets, key)
+		}
+	}
+}
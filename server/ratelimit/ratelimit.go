@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gogap/config"
+)
+
+// Store keeps the token buckets and the counters of the clients
+type Store interface {
+	// TakeTokens takes n tokens from the bucket of key, the bucket holds
+	// capacity tokens at most, and refills one token every interval
+	TakeTokens(key string, n, capacity int64, interval time.Duration) (remaining int64, ok bool, err error)
+	// AddCount adds n to the counter of key if the result is not more than
+	// max, the counter is reset after expire
+	AddCount(key string, n, max int64, expire time.Time) (count int64, ok bool, err error)
+}
+
+type NewStoreFunc func(config.Configuration) (Store, error)
+
+var (
+	newStoreFuncs = make(map[string]NewStoreFunc)
+)
+
+func New(name string, conf config.Configuration) (s Store, err error) {
+	fn, exist := newStoreFuncs[name]
+	if !exist {
+		err = fmt.Errorf("rate limit store driver of %s not exist", name)
+		return
+	}
+
+	return fn(conf)
+}
+
+func RegisterStore(name string, fn NewStoreFunc) (err error) {
+
+	if len(name) == 0 {
+		err = fmt.Errorf("rate limit store driver name is empty")
+		return
+	}
+
+	if fn == nil {
+		err = fmt.Errorf("the rate limit store driver of %s's new func is nil", name)
+		return
+	}
+
+	_, exist := newStoreFuncs[name]
+
+	if exist {
+		err = fmt.Errorf("driver of %s already exist", name)
+		return
+	}
+
+	newStoreFuncs[name] = fn
+
+	return
+}
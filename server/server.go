@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"text/template"
@@ -15,6 +20,7 @@ import (
 	"github.com/TV4/graceful"
 	"github.com/gogap/config"
 	"github.com/gogap/go-pandoc/pandoc"
+	"github.com/gogap/go-pandoc/pandoc/fetcher"
 	"github.com/gorilla/mux"
 	"github.com/phyber/negroni-gzip/gzip"
 	"github.com/rs/cors"
@@ -23,38 +29,63 @@ import (
 )
 
 const (
-	defaultTemplateText = `{"code":{{.Code}},"message":"{{.Message}}"{{if .Result}},"result":{{.Result|jsonify}}{{end}}}`
+	defaultTemplateText = `{"code":{{.Code}},"message":{{.Message|jsonify}}{{if .Result}},"result":{{.Result|jsonify}}{{end}}{{if .Error}},"error":{{.Error|jsonify}}{{end}}}`
 )
 
 var (
 	pdoc *pandoc.Pandoc
 
+	jobs *jobManager
+
+	metrics *serverMetrics
+
+	limiter *rateLimiter
+
 	renderTmpls = make(map[string]*template.Template)
 
 	defaultTmpl *template.Template
+
+	// the code of error response is the http status, otherwise 200 as before
+	errorStatus bool
 )
 
 type ConvertData struct {
-	Data []byte `json:"data"`
+	Data  []byte              `json:"data"`
+	Files []pandoc.OutputFile `json:"files,omitempty"`
+	From  string              `json:"from,omitempty"` // the input format, detected if from is empty
 }
 
 type ConvertArgs struct {
 	Fetcher   *pandoc.FetcherOptions `json:"fetcher"`
 	Converter *pandoc.ConvertOptions `json:"converter"`
 	Template  string                 `json:"template"`
+	Callback  *CallbackOptions       `json:"callback"`
 }
 
 type TemplateArgs struct {
-	From string
-	To   string
+	From   string
+	To     string
+	Output string
 	ConvertResponse
 	Response *RespHelper
+
+	ErrorStatus int // the http status of error, the code if service.error-status is enabled, otherwise 400
 }
 
 type ConvertResponse struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Result  interface{} `json:"result"`
+	Error   *ErrorInfo  `json:"error,omitempty"`
+}
+
+// ErrorInfo is the machine-readable detail of the error response
+type ErrorInfo struct {
+	Type     string `json:"type"`
+	Fetcher  string `json:"fetcher,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	Log      string `json:"log,omitempty"` // the excerpt of latex log
 }
 
 type serverWrapper struct {
@@ -67,6 +98,9 @@ type serverWrapper struct {
 	n         *negroni.Negroni
 
 	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func (p *serverWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -78,10 +112,18 @@ func (p *serverWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (p *serverWrapper) ListenAndServe() (err error) {
 
+	srv := &http.Server{
+		Addr:    p.addr,
+		Handler: p,
+		BaseContext: func(net.Listener) context.Context {
+			return p.ctx
+		},
+	}
+
 	if p.tls {
-		err = http.ListenAndServeTLS(p.addr, p.certFile, p.keyFile, p)
+		err = srv.ListenAndServeTLS(p.certFile, p.keyFile)
 	} else {
-		err = http.ListenAndServe(p.addr, p)
+		err = srv.ListenAndServe()
 	}
 
 	return
@@ -104,8 +146,12 @@ func (p *serverWrapper) Shutdown(ctx context.Context) error {
 		if timeDiff > p.timeout {
 			break
 		}
+		num = atomic.LoadInt64(&p.reqNumber)
 	}
 
+	// abort the conversions still running, it kills the pandoc processes
+	p.cancel()
+
 	log.Printf("[%s] Shutdown finished, Address: %s\n", schema, p.addr)
 
 	return nil
@@ -128,6 +174,8 @@ func New(conf config.Configuration) (srv *PandocServer, err error) {
 		return
 	}
 
+	errorStatus = serviceConf.GetBoolean("error-status", false)
+
 	// init templates
 
 	defaultTmpl, err = template.New("default").Funcs(funcMap).Parse(defaultTemplateText)
@@ -166,6 +214,39 @@ func New(conf config.Configuration) (srv *PandocServer, err error) {
 		Methods("POST").
 		HandlerFunc(handlePandocToX)
 
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+
+	if serviceConf.GetBoolean("jobs.enabled", true) {
+
+		jobs, err = newJobManager(ctx, serviceConf.GetConfig("jobs"))
+
+		if err != nil {
+			return
+		}
+
+		r.PathPrefix(pathPrefix).Path("/jobs").
+			Methods("POST").
+			HandlerFunc(handleCreateJob)
+
+		r.PathPrefix(pathPrefix).Path("/jobs/{id}").
+			Methods("GET").
+			HandlerFunc(handleJobStatus)
+
+		r.PathPrefix(pathPrefix).Path("/jobs/{id}/result").
+			Methods("GET").
+			HandlerFunc(handleJobResult)
+	}
+
+	r.PathPrefix(pathPrefix).Path("/capabilities").
+		Methods("GET").
+		HandlerFunc(handleCapabilities)
+
 	r.PathPrefix(pathPrefix).Path("/ping").
 		Methods("GET", "HEAD").HandlerFunc(
 		func(rw http.ResponseWriter, req *http.Request) {
@@ -174,10 +255,57 @@ func New(conf config.Configuration) (srv *PandocServer, err error) {
 		},
 	)
 
+	var servers []*serverWrapper
+
+	if serviceConf.GetBoolean("metrics.enabled", true) {
+
+		metrics = newServerMetrics(func() []*serverWrapper { return servers })
+
+		pdoc.SetObserver(metrics)
+
+		r.Path(serviceConf.GetString("metrics.path", "/metrics")).
+			Methods("GET").
+			Handler(metrics.Handler())
+	}
+
 	n := negroni.Classic()
 
+	if metrics != nil {
+		n.Use(metrics)
+	}
+
 	n.Use(c) // use cors
 
+	if serviceConf.GetBoolean("auth.enabled", false) {
+
+		var auth *authenticator
+
+		auth, err = newAuthenticator(
+			serviceConf.GetConfig("auth"),
+			strings.TrimRight(pathPrefix, "/")+"/ping",
+			serviceConf.GetString("metrics.path", "/metrics"),
+		)
+
+		if err != nil {
+			return
+		}
+
+		n.Use(auth)
+	}
+
+	if serviceConf.GetBoolean("rate-limit.enabled", false) {
+
+		limiter, err = newRateLimiter(serviceConf.GetConfig("rate-limit"))
+
+		if err != nil {
+			return
+		}
+	}
+
+	if maxBodySize := serviceConf.GetInt64("max-body-size", 128<<20); maxBodySize > 0 {
+		n.UseFunc(limitRequestBody(maxBodySize))
+	}
+
 	if serviceConf.GetBoolean("gzip-enabled", true) {
 		n.Use(gzip.Gzip(gzip.DefaultCompression))
 	}
@@ -189,8 +317,6 @@ func New(conf config.Configuration) (srv *PandocServer, err error) {
 	enableHTTP := serviceConf.GetBoolean("http.enabled", true)
 	enableHTTPS := serviceConf.GetBoolean("https.enabled", false)
 
-	var servers []*serverWrapper
-
 	if enableHTTP {
 
 		listenAddr := serviceConf.GetString("http.address", "127.0.0.1:8080")
@@ -199,6 +325,8 @@ func New(conf config.Configuration) (srv *PandocServer, err error) {
 			n:       n,
 			timeout: gracefulTimeout,
 			addr:    listenAddr,
+			ctx:     ctx,
+			cancel:  cancel,
 		}
 
 		servers = append(servers, httpServer)
@@ -217,6 +345,8 @@ func New(conf config.Configuration) (srv *PandocServer, err error) {
 			tls:      true,
 			certFile: certFile,
 			keyFile:  keyFile,
+			ctx:      ctx,
+			cancel:   cancel,
 		}
 
 		servers = append(servers, httpsServer)
@@ -267,16 +397,26 @@ func writeResp(rw http.ResponseWriter, convertArgs ConvertArgs, resp ConvertResp
 		}
 	}
 
+	if resp.Code != 0 && resp.Error == nil {
+		resp.Error = &ErrorInfo{Type: errorTypeOfCode(resp.Code)}
+	}
+
 	respHelper := newRespHelper(rw)
 
 	args := TemplateArgs{
 		ConvertResponse: resp,
 		Response:        respHelper,
+		ErrorStatus:     http.StatusBadRequest,
+	}
+
+	if errorStatus && resp.Code != 0 {
+		args.ErrorStatus = resp.Code
 	}
 
 	if convertArgs.Converter != nil {
 		args.From = convertArgs.Converter.From
 		args.To = convertArgs.Converter.To
+		args.Output = convertArgs.Converter.OutputMode
 	}
 
 	buf := bytes.NewBuffer(nil)
@@ -288,49 +428,211 @@ func writeResp(rw http.ResponseWriter, convertArgs ConvertArgs, resp ConvertResp
 	}
 
 	if !respHelper.Holding() {
+		if errorStatus && resp.Code != 0 {
+			rw.WriteHeader(resp.Code)
+		}
 		rw.Write(buf.Bytes())
 	}
 }
 
-func handlePandocToX(rw http.ResponseWriter, req *http.Request) {
+func decodeConvertArgs(req *http.Request) (args ConvertArgs, err error) {
 
 	decoder := json.NewDecoder(req.Body)
 
 	decoder.UseNumber()
 
-	args := ConvertArgs{}
-
-	err := decoder.Decode(&args)
+	err = decoder.Decode(&args)
 
 	if err != nil {
-		writeResp(rw, args, ConvertResponse{http.StatusBadRequest, err.Error(), nil})
 		return
 	}
 
 	if args.Converter == nil {
-		writeResp(rw, args, ConvertResponse{http.StatusBadRequest, "converter options is nil", nil})
+		err = errors.New("converter options is nil")
 		return
 	}
 
 	if args.Fetcher == nil {
-		writeResp(rw, args, ConvertResponse{http.StatusBadRequest, "fetcher options is nil", nil})
+		err = errors.New("fetcher options is nil")
+		return
+	}
+
+	// the from and to of preset are checked by auth
+	err = pdoc.ApplyPreset(args.Converter)
+
+	return
+}
+
+func handlePandocToX(rw http.ResponseWriter, req *http.Request) {
+
+	if isMultipart(req) {
+		handleMultipartToX(rw, req)
+		return
+	}
+
+	args, err := decodeConvertArgs(req)
+
+	if err != nil {
+		writeResp(rw, args, convertErrorResponse(err))
+		return
+	}
+
+	if err = checkPermission(req, args); err != nil {
+		writeResp(rw, args, ConvertResponse{http.StatusForbidden, err.Error(), nil, nil})
+		return
+	}
+
+	if err = limiter.Allow(rw, req, args); err != nil {
+		writeResp(rw, args, ConvertResponse{rateLimitErrorCode(rw, err), err.Error(), nil, nil})
 		return
 	}
 
-	var convData []byte
+	begin := time.Now()
 
-	convData, err = pdoc.Convert(*args.Fetcher, *args.Converter)
+	result, err := pdoc.RunContext(req.Context(), *args.Fetcher, *args.Converter)
+
+	metrics.observeConvert(args.Converter, begin, result, err)
 
 	if err != nil {
-		writeResp(rw, args, ConvertResponse{http.StatusBadRequest, err.Error(), nil})
+		writeResp(rw, args, convertErrorResponse(err))
 		return
 	}
 
-	writeResp(rw, args, ConvertResponse{0, "", ConvertData{Data: convData}})
+	writeConvertResult(rw, args, result)
 
 	return
 }
 
+func writeConvertResult(rw http.ResponseWriter, args ConvertArgs, result *pandoc.Result) {
+
+	rw.Header().Set("X-Queue-Wait", strconv.FormatInt(int64(result.QueueWait/time.Millisecond), 10))
+	rw.Header().Set("X-Input-Format", result.From)
+
+	if args.Converter != nil && args.Converter.From != result.From {
+		converter := *args.Converter
+		converter.From = result.From
+		args.Converter = &converter
+	}
+
+	if pdoc.CacheEnabled() {
+		if result.Cached {
+			rw.Header().Set("X-Cache", "HIT")
+		} else {
+			rw.Header().Set("X-Cache", "MISS")
+		}
+	}
+
+	writeResp(rw, args, ConvertResponse{0, "", ConvertData{Data: result.Data, Files: result.Files, From: result.From}, nil})
+}
+
+// convertErrorResponse returns the invalid fields as result if err is a
+// validation error of converter options
+func convertErrorResponse(err error) ConvertResponse {
+	resp := ConvertResponse{convertErrorCode(err), err.Error(), nil, convertErrorInfo(err)}
+
+	if verr, ok := err.(*pandoc.ValidationError); ok {
+		resp.Result = verr
+	}
+
+	return resp
+}
+
+// the max bytes of pandoc stderr in the error response, the tail is kept
+const maxStderrSize = 4096
+
+// convertErrorInfo returns the type, and the fetcher, exit code, stderr
+// and latex log if the error has them
+func convertErrorInfo(err error) *ErrorInfo {
+	info := &ErrorInfo{Type: string(pandoc.ErrorTypeOf(err))}
+
+	var (
+		fetchErr *pandoc.FetchError
+		exitErr  *pandoc.ExitError
+		latexErr *pandoc.LatexError
+	)
+
+	if errors.As(err, &fetchErr) {
+		info.Fetcher = fetchErr.Fetcher
+	}
+
+	if errors.As(err, &exitErr) {
+		info.ExitCode = exitErr.Code
+		info.Stderr = exitErr.Stderr
+
+		if len(info.Stderr) > maxStderrSize {
+			info.Stderr = info.Stderr[len(info.Stderr)-maxStderrSize:]
+		}
+	}
+
+	if errors.As(err, &latexErr) {
+		info.Log = latexErr.Log
+	}
+
+	return info
+}
+
+func convertErrorCode(err error) int {
+	switch pandoc.ErrorTypeOf(err) {
+	case pandoc.ErrorTypeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case pandoc.ErrorTypeQueueFull:
+		return http.StatusTooManyRequests
+	case pandoc.ErrorTypeQueueTimeout:
+		return http.StatusServiceUnavailable
+	case pandoc.ErrorTypeTimeout:
+		return http.StatusGatewayTimeout
+	case pandoc.ErrorTypeCanceled:
+		return http.StatusRequestTimeout
+	case pandoc.ErrorTypeFetch:
+		return http.StatusBadGateway
+	case pandoc.ErrorTypePandoc, pandoc.ErrorTypeLatex:
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusBadRequest
+}
+
+// errorTypeOfCode is the type of the errors not returned by conversion
+func errorTypeOfCode(code int) string {
+	switch code {
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return string(pandoc.ErrorTypeTooLarge)
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusInternalServerError:
+		return "internal"
+	}
+
+	return string(pandoc.ErrorTypeInvalid)
+}
+
+// limitRequestBody rejects the request body larger than maxSize, the body
+// is also limited while reading in case the content length is unknown
+func limitRequestBody(maxSize int64) negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+		if req.ContentLength > maxSize {
+			err := &fetcher.PayloadTooLargeError{Payload: "request body", Limit: maxSize}
+			writeResp(rw, ConvertArgs{}, ConvertResponse{http.StatusRequestEntityTooLarge, err.Error(), nil, nil})
+			return
+		}
+
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{fetcher.LimitReader(req.Body, maxSize, "request body"), req.Body}
+
+		next(rw, req)
+	}
+}
+
 func loadTemplates(tmplsConf config.Configuration) (err error) {
 	if tmplsConf == nil {
 		return
@@ -410,3 +712,14 @@ func (p *RespHelper) WriteHeader(code interface{}) error {
 
 	return nil
 }
+
+func handleCapabilities(rw http.ResponseWriter, req *http.Request) {
+	caps := pdoc.Capabilities()
+
+	if caps == nil {
+		writeResp(rw, ConvertArgs{}, ConvertResponse{http.StatusServiceUnavailable, "the capabilities of pandoc are unknown", nil, nil})
+		return
+	}
+
+	writeResp(rw, ConvertArgs{}, ConvertResponse{0, "", caps, nil})
+}
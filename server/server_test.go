@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"github.com/gogap/config"
+	"github.com/gogap/go-pandoc/pandoc"
+)
+
+func TestWriteErrorResp(t *testing.T) {
+	defaultTmpl = template.Must(template.New("default").Funcs(funcMap).Parse(defaultTemplateText))
+
+	err := loadTemplates(config.NewConfig(config.ConfigString(`binary { template = "../templates/binary.tmpl" }`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { errorStatus = false }()
+
+	latexErr := &pandoc.LatexError{ExitError: &pandoc.ExitError{Code: 43, Stderr: "Error producing PDF.\n! x"}, Engine: "xelatex", Log: "! x"}
+	fetchErr := &pandoc.FetchError{Fetcher: "http", Err: errors.New("status code is 404")}
+
+	tests := []struct {
+		errorStatus bool
+		template    string
+		resp        ConvertResponse
+		status      int
+		body        string
+	}{
+		{false, "", convertErrorResponse(latexErr), http.StatusOK,
+			`{"code":422,"message":"xelatex failure, ! x","error":{"type":"latex","exit_code":43,"stderr":"Error producing PDF.\n! x","log":"! x"}}`},
+		{true, "", convertErrorResponse(latexErr), http.StatusUnprocessableEntity,
+			`{"code":422,"message":"xelatex failure, ! x","error":{"type":"latex","exit_code":43,"stderr":"Error producing PDF.\n! x","log":"! x"}}`},
+		{false, "", ConvertResponse{http.StatusForbidden, "not allowed", nil, nil}, http.StatusOK,
+			`{"code":403,"message":"not allowed","error":{"type":"forbidden"}}`},
+		{true, "", convertErrorResponse(fetchErr), http.StatusBadGateway,
+			`{"code":502,"message":"fetch by http failure, error: status code is 404","error":{"type":"fetch","fetcher":"http"}}`},
+		{false, "binary", convertErrorResponse(fetchErr), http.StatusBadRequest,
+			"fetch by http failure, error: status code is 404"},
+		{true, "binary", convertErrorResponse(fetchErr), http.StatusBadGateway,
+			"fetch by http failure, error: status code is 404"},
+		{true, "", ConvertResponse{0, "", ConvertData{Data: []byte("ok")}, nil}, http.StatusOK,
+			`{"code":0,"message":"","result":{"data":"b2s="}}`},
+	}
+
+	for i, test := range tests {
+		errorStatus = test.errorStatus
+
+		rw := httptest.NewRecorder()
+
+		writeResp(rw, ConvertArgs{Template: test.template}, test.resp)
+
+		if rw.Code != test.status || rw.Body.String() != test.body {
+			t.Fatalf("test %d, status: %d, body: %s", i, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestWriteBinaryResp(t *testing.T) {
+	defaultTmpl = template.Must(template.New("default").Funcs(funcMap).Parse(defaultTemplateText))
+
+	err := loadTemplates(config.NewConfig(config.ConfigString(`binary { template = "../templates/binary.tmpl" }`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []pandoc.OutputFile{{Name: "output.html", Size: 2, Data: []byte("ok")}}
+
+	tests := []struct {
+		converter   pandoc.ConvertOptions
+		data        ConvertData
+		contentType string
+		body        string
+	}{
+		{pandoc.ConvertOptions{To: "html"}, ConvertData{Data: []byte("ok")}, "text/plain; charset=utf-8", "ok"},
+		{pandoc.ConvertOptions{To: "pdf"}, ConvertData{Data: []byte("%PDF")}, "application/pdf", "%PDF"},
+		{pandoc.ConvertOptions{To: "html", OutputMode: pandoc.OutputModeZip}, ConvertData{Data: []byte("zip")}, "application/zip", "zip"},
+		{pandoc.ConvertOptions{To: "html", OutputMode: pandoc.OutputModeManifest}, ConvertData{Files: files}, "application/json",
+			`[{"name":"output.html","size":2,"data":"b2s="}]`},
+	}
+
+	for i, test := range tests {
+		rw := httptest.NewRecorder()
+
+		converter := test.converter
+		writeResp(rw, ConvertArgs{Template: "binary", Converter: &converter}, ConvertResponse{0, "", test.data, nil})
+
+		if rw.Code != http.StatusOK || rw.Header().Get("Content-Type") != test.contentType || rw.Body.String() != test.body {
+			t.Fatalf("test %d, status: %d, content type: %s, body: %s", i, rw.Code, rw.Header().Get("Content-Type"), rw.Body.String())
+		}
+	}
+}